@@ -4,21 +4,21 @@ import "fmt"
 
 // Inchi split in its components
 type Inchi struct {
-	Version               string `json:"version"`
-	Formula               string `json:"formula"`
-	Connections           string `json:"connections"`
-	HAtoms                string `json:"h_atoms"`
-	Charge                string `json:"charge"`
-	Protons               string `json:"protons"`
-	StereoDbond           string `json:"stereo_dbond"`
-	StereoSP3             string `json:"stereo_SP3"`
-	StereoSP3inverted     string `json:"stereo_SP3_inverted"`
-	StereoType            string `json:"stereo_type"`
-	IsotopicAtoms         string `json:"isotopic_atoms"`
-	IsotopicExchangeableH string `json:"isotopic_exchangeable_h"`
-	FullStereo            string `json:"full_stereo"`
-	FullIsotopic          string `json:"full_isotopic"`
-	Inchi                 string `json:"inchi"`
+	Version               string `json:"version" bson:"version"`
+	Formula               string `json:"formula" bson:"formula"`
+	Connections           string `json:"connections" bson:"connections"`
+	HAtoms                string `json:"h_atoms" bson:"hAtoms"`
+	Charge                string `json:"charge" bson:"charge"`
+	Protons               string `json:"protons" bson:"protons"`
+	StereoDbond           string `json:"stereo_dbond" bson:"stereoDbond"`
+	StereoSP3             string `json:"stereo_SP3" bson:"stereoSP3"`
+	StereoSP3inverted     string `json:"stereo_SP3_inverted" bson:"stereoSP3Inverted"`
+	StereoType            string `json:"stereo_type" bson:"stereoType"`
+	IsotopicAtoms         string `json:"isotopic_atoms" bson:"isotopicAtoms"`
+	IsotopicExchangeableH string `json:"isotopic_exchangeable_h" bson:"isotopicExchangeableH"`
+	FullStereo            string `json:"full_stereo" bson:"fullStereo"`
+	FullIsotopic          string `json:"full_isotopic" bson:"fullIsotopic"`
+	Inchi                 string `json:"inchi" bson:"inchi"`
 }
 
 func (inchi *Inchi) buildInchiString() string {
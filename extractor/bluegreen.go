@@ -0,0 +1,247 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BlueGreen full extractions write into a new versioned index, <index>-YYYYMMDD-<release>,
+// and the index name becomes an alias moved to it once the load is validated
+type BlueGreen struct {
+	Enabled bool
+	// Release tells apart the indices built on the same day, the time of the run
+	// when empty
+	Release string
+	// Keep versioned indices kept for rollback, the live one included
+	Keep int
+}
+
+const defaultBlueGreenKeep = 3
+
+// KeepIndices the versioned indices kept after a swap, 3 by default
+func (b BlueGreen) KeepIndices() int {
+	if b.Keep > 0 {
+		return b.Keep
+	}
+	return defaultBlueGreenKeep
+}
+
+// releasePattern what a release is made of, a hyphen in it would make the
+// versioned indices ambiguous
+var releasePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// validRelease whether release can be part of a versioned index name
+func validRelease(release string) bool {
+	return releasePattern.MatchString(strings.ToLower(release))
+}
+
+// isVersionedIndex whether index is a versioned index of alias,
+// <alias>-YYYYMMDD-<release>, and not some other index sharing its prefix
+func isVersionedIndex(alias, index string) bool {
+	rest := strings.TrimPrefix(index, strings.ToLower(alias)+"-")
+	if rest == index || len(rest) < 10 || rest[8] != '-' {
+		return false
+	}
+	if _, err := time.Parse("20060102", rest[:8]); err != nil {
+		return false
+	}
+	return validRelease(rest[9:])
+}
+
+// versionedIndex the index a full extraction started at t writes into
+func (b BlueGreen) versionedIndex(alias string, t time.Time) string {
+	release := b.Release
+	if len(release) == 0 {
+		release = t.Format("150405")
+	}
+	return strings.ToLower(fmt.Sprintf("%s-%s-%s", alias, t.Format("20060102"), release))
+}
+
+// blueGreenRun the versioned index of a full extraction and the alias it
+// replaces once validated
+type blueGreenRun struct {
+	logger *zap.SugaredLogger
+	client *restClient
+	conf   *Configuration
+	alias  string
+	// target the configuration of the extraction, writing into the versioned index
+	target *Configuration
+}
+
+// newBlueGreenRun creates the versioned index, or takes the one of the
+// checkpoint when resuming. The alias name must not be a concrete index
+func newBlueGreenRun(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, cp *CheckpointStore) (*blueGreenRun, error) {
+	bg := &blueGreenRun{
+		logger: l,
+		client: newRestClient(conf.ElasticHost, conf.ElasticAuth),
+		conf:   conf,
+		alias:  conf.IndexName(),
+	}
+
+	current, err := bg.client.aliasIndices(ctx, bg.alias)
+	if err != nil {
+		return nil, tagError(ErrSinkUnavailable, err)
+	}
+	if current == nil {
+		ex, err := bg.client.indexExists(ctx, bg.alias)
+		if err != nil {
+			return nil, tagError(ErrSinkUnavailable, err)
+		}
+		if ex {
+			return nil, fmt.Errorf("%w: %s is an index, not an alias. Reindex it into a versioned index or delete it before a blue/green run", ErrConfig, bg.alias)
+		}
+	}
+
+	index := cp.Target()
+	if len(index) == 0 {
+		index = conf.BlueGreen.versionedIndex(bg.alias, time.Now())
+		err = cp.SetTarget(index)
+		checkpointError(l, os.Stdout, err)
+	}
+
+	ex, err := bg.client.indexExists(ctx, index)
+	if err != nil {
+		return nil, tagError(ErrSinkUnavailable, err)
+	}
+	if !ex {
+		m := fmt.Sprintf("Creating versioned index %s for alias %s", index, bg.alias)
+		fmt.Println(m)
+		l.Info(m)
+		err = bg.client.createIndex(ctx, index, conf.IndexSettings())
+		if err != nil {
+			return nil, tagError(ErrSinkRejected, err)
+		}
+	} else {
+		l.Infof("Versioned index %s exists, resuming into it", index)
+	}
+
+	target := *conf
+	target.Index = index
+	bg.target = &target
+	return bg, nil
+}
+
+// promote validates the versioned index against the database, when the source
+// is one, moves the alias to it in a single request and prunes the old indices
+func (bg *blueGreenRun) promote(ctx context.Context) error {
+	l := bg.logger
+	index := bg.target.Index
+
+	if bg.conf.UsesDatabase() && bg.conf.SinkName() == "elasticsearch" {
+		match, err := ValidateLoad(ctx, l, bg.target)
+		if err != nil {
+			return err
+		}
+		if !match {
+			m := fmt.Sprintf("Alias %s left as it was, the counts of %s don't match the database", bg.alias, index)
+			fmt.Println(m)
+			l.Error(m)
+			return fmt.Errorf("%w: %s", ErrCountMismatch, index)
+		}
+	} else {
+		m := fmt.Sprintf("%s source and %s sink, %s is promoted without validating its count", bg.conf.DBDriver(), bg.conf.SinkName(), index)
+		fmt.Println(m)
+		l.Warn(m)
+	}
+
+	current, err := bg.client.aliasIndices(ctx, bg.alias)
+	if err != nil {
+		return tagError(ErrSinkUnavailable, err)
+	}
+	var actions []map[string]map[string]string
+	for _, c := range current {
+		if c != index {
+			actions = append(actions, map[string]map[string]string{"remove": {"index": c, "alias": bg.alias}})
+		}
+	}
+	actions = append(actions, map[string]map[string]string{"add": {"index": index, "alias": bg.alias}})
+	err = bg.client.updateAliases(ctx, actions)
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+	m := fmt.Sprintf("Alias %s moved from %v to %s", bg.alias, current, index)
+	fmt.Println(m)
+	l.Info(m)
+
+	bg.prune(ctx, index)
+	return nil
+}
+
+// prune deletes the oldest versioned indices of the alias beyond the ones kept,
+// failures are only logged, the swap is already done. Indices only sharing the
+// alias prefix, like <alias>-staging, are left alone
+func (bg *blueGreenRun) prune(ctx context.Context, live string) {
+	l := bg.logger
+	all, err := bg.client.catIndices(ctx, bg.alias+"-*")
+	if err != nil {
+		l.Error("Error listing versioned indices ", err)
+		return
+	}
+	var indices []catIndex
+	for _, in := range all {
+		if isVersionedIndex(bg.alias, in.Index) {
+			indices = append(indices, in)
+		}
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i].CreationDate > indices[j].CreationDate })
+
+	kept := 0
+	for _, in := range indices {
+		if in.Index == live || kept < bg.conf.BlueGreen.KeepIndices()-1 {
+			if in.Index != live {
+				kept++
+			}
+			continue
+		}
+		m := fmt.Sprintf("Deleting versioned index %s", in.Index)
+		fmt.Println(m)
+		l.Info(m)
+		err := bg.client.deleteIndex(ctx, in.Index)
+		if err != nil {
+			l.Error("Error deleting versioned index ", err)
+		}
+	}
+}
+
+// aliasIndices the indices holding the alias, nil when it doesn't exist
+func (c *restClient) aliasIndices(ctx context.Context, alias string) ([]string, error) {
+	var res map[string]interface{}
+	code, err := c.do(ctx, http.MethodGet, "/_alias/"+alias, nil, "", &res)
+	if err != nil || code == http.StatusNotFound {
+		return nil, err
+	}
+	var indices []string
+	for i := range res {
+		indices = append(indices, i)
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+type catIndex struct {
+	Index        string `json:"index"`
+	CreationDate string `json:"creation.date"`
+}
+
+// catIndices the indices matching pattern with their creation date, epoch
+// milliseconds of the same length for the years to come
+func (c *restClient) catIndices(ctx context.Context, pattern string) ([]catIndex, error) {
+	var res []catIndex
+	q := url.Values{"format": {"json"}, "h": {"index,creation.date"}}
+	_, err := c.do(ctx, http.MethodGet, "/_cat/indices/"+pattern+"?"+q.Encode(), nil, "", &res)
+	return res, err
+}
+
+func (c *restClient) deleteIndex(ctx context.Context, index string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/"+index, nil, "", nil)
+	return err
+}
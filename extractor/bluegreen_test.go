@@ -0,0 +1,32 @@
+package extractor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsVersionedIndex(t *testing.T) {
+	for _, tc := range []struct {
+		index string
+		want  bool
+	}{
+		{"unichem-20261016-2026_10", true},
+		{"unichem-20261016-153000", true},
+		{"unichem-staging", false},
+		{"unichem-staging-20261016-1", false},
+		{"unichem-20261016", false},
+		{"unichem-20261399-1", false},
+		{"unichem-20261016-a-b", false},
+		{"unichem2-20261016-1", false},
+		{"unichem", false},
+	} {
+		if got := isVersionedIndex("unichem", tc.index); got != tc.want {
+			t.Errorf("isVersionedIndex(%q) = %t, want %t", tc.index, got, tc.want)
+		}
+	}
+
+	b := BlueGreen{Release: "R_1"}
+	if i := b.versionedIndex("UniChem", time.Now()); !isVersionedIndex("UniChem", i) {
+		t.Errorf("%s not taken as a versioned index", i)
+	}
+}
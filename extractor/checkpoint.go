@@ -0,0 +1,219 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PartitionCheckpoint progress of a partition. LastUCI is the highest UCI
+// confirmed by the sink with every batch before it confirmed as well
+type PartitionCheckpoint struct {
+	Start     int       `json:"start"`
+	Finish    int       `json:"finish"`
+	LastUCI   int       `json:"lastUci"`
+	Done      bool      `json:"done"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type checkpointFile struct {
+	// Plan identifies the partitions of the run, a checkpoint is only resumed by
+	// a run with the same plan
+	Plan string `json:"plan"`
+	// Target versioned index of a blue/green run, resumed into the same one
+	Target string `json:"target,omitempty"`
+	// LoadSettings index settings to restore, kept until the load restores them,
+	// LoadIndex the index they belong to
+	LoadSettings *loadSettings                  `json:"loadSettings,omitempty"`
+	LoadIndex    string                         `json:"loadIndex,omitempty"`
+	Partitions   map[string]PartitionCheckpoint `json:"partitions"`
+}
+
+// CheckpointStore keeps the progress of every partition in a JSON file, written
+// after each confirmed batch so a crashed run can be resumed
+type CheckpointStore struct {
+	path string
+	mu   sync.Mutex
+	data checkpointFile
+}
+
+// planID describes the partitions planned for the configuration, along with
+// where they are read from and written to
+func planID(conf *Configuration, partitions []Partition) string {
+	return fmt.Sprintf("driver=%s sink=%s index=%s ranges=%v interval=%d partitions=%d",
+		conf.DBDriver(), conf.SinkName(), conf.Index, conf.Ranges(), conf.Interval, len(partitions))
+}
+
+// OpenCheckpointStore loads the checkpoint at path when resume is set, its plan
+// must match the partitions given. Otherwise a new checkpoint is started, only
+// keeping the index settings a crashed load left to restore
+func OpenCheckpointStore(path string, plan string, partitions []Partition, resume bool) (*CheckpointStore, error) {
+	cs := &CheckpointStore{
+		path: path,
+		data: checkpointFile{Plan: plan, Partitions: map[string]PartitionCheckpoint{}},
+	}
+
+	if resume {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading checkpoint to resume: %w", err)
+		}
+		var f checkpointFile
+		err = json.Unmarshal(b, &f)
+		if err != nil {
+			return nil, fmt.Errorf("reading checkpoint %s: %w", path, err)
+		}
+		if f.Plan != plan {
+			return nil, fmt.Errorf("checkpoint %s was written for a different plan (%s), current one is %s", path, f.Plan, plan)
+		}
+		if f.Partitions != nil {
+			cs.data.Partitions = f.Partitions
+		}
+		cs.data.Target = f.Target
+		cs.data.LoadSettings = f.LoadSettings
+		cs.data.LoadIndex = f.LoadIndex
+	} else if b, err := ioutil.ReadFile(path); err == nil {
+		var f checkpointFile
+		if json.Unmarshal(b, &f) == nil {
+			cs.data.LoadSettings = f.LoadSettings
+			cs.data.LoadIndex = f.LoadIndex
+		}
+	}
+
+	for _, p := range partitions {
+		k := strconv.Itoa(p.ID)
+		if _, ok := cs.data.Partitions[k]; !ok {
+			cs.data.Partitions[k] = PartitionCheckpoint{Start: p.Start, Finish: p.Finish}
+		}
+	}
+
+	return cs, cs.save()
+}
+
+// Target the versioned index the checkpoint was written for, empty when none
+func (cs *CheckpointStore) Target() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.data.Target
+}
+
+// SetTarget records the versioned index written to
+func (cs *CheckpointStore) SetTarget(index string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.data.Target = index
+	return cs.save()
+}
+
+// loadSettings the settings of index saved before tuning it for the load, nil
+// when none are pending restoration
+func (cs *CheckpointStore) loadSettings(index string) *loadSettings {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.data.LoadIndex) > 0 && cs.data.LoadIndex != index {
+		return nil
+	}
+	return cs.data.LoadSettings
+}
+
+// setLoadSettings saves the settings of index to restore, nil once restored
+func (cs *CheckpointStore) setLoadSettings(index string, ls *loadSettings) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.data.LoadSettings = ls
+	cs.data.LoadIndex = index
+	if ls == nil {
+		cs.data.LoadIndex = ""
+	}
+	return cs.save()
+}
+
+// Get the checkpoint of a partition
+func (cs *CheckpointStore) Get(id int) PartitionCheckpoint {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.data.Partitions[strconv.Itoa(id)]
+}
+
+// Confirm records uci as the partition's last contiguous confirmed UCI
+func (cs *CheckpointStore) Confirm(id, uci int) error {
+	return cs.update(id, func(pc *PartitionCheckpoint) {
+		if uci > pc.LastUCI {
+			pc.LastUCI = uci
+		}
+	})
+}
+
+// Done marks the partition as finished, it is skipped when resuming
+func (cs *CheckpointStore) Done(id int) error {
+	return cs.update(id, func(pc *PartitionCheckpoint) {
+		pc.Done = true
+	})
+}
+
+func (cs *CheckpointStore) update(id int, f func(pc *PartitionCheckpoint)) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	k := strconv.Itoa(id)
+	pc := cs.data.Partitions[k]
+	f(&pc)
+	pc.UpdatedAt = time.Now()
+	cs.data.Partitions[k] = pc
+	return cs.save()
+}
+
+// Save writes the checkpoint file
+func (cs *CheckpointStore) Save() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.save()
+}
+
+// save writes to a temporary file first, a crash while writing leaves the
+// previous checkpoint in place
+func (cs *CheckpointStore) save() error {
+	b, err := json.MarshalIndent(cs.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := cs.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, cs.path)
+}
+
+// batchWatermark follows the batches confirmed by a Sink, out of order, and
+// yields the last UCI of the longest run of confirmed batches from the first one
+type batchWatermark struct {
+	next    int
+	pending map[int]int
+	uci     int
+}
+
+func newBatchWatermark() *batchWatermark {
+	return &batchWatermark{next: 1, pending: map[int]int{}}
+}
+
+// confirm the batch whose last UCI is given, returns whether the watermark moved
+func (bw *batchWatermark) confirm(batch, uci int) bool {
+	bw.pending[batch] = uci
+	moved := false
+	for {
+		u, ok := bw.pending[bw.next]
+		if !ok {
+			return moved
+		}
+		delete(bw.pending, bw.next)
+		bw.next++
+		if u > bw.uci {
+			bw.uci = u
+		}
+		moved = true
+	}
+}
@@ -0,0 +1,46 @@
+package extractor
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPendingLoadSettingsSurviveAFreshRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	partitions := []Partition{{ID: 1, Start: 1, Finish: 10}}
+	refresh, replicas := "30s", "2"
+
+	cp, err := OpenCheckpointStore(path, "plan", partitions, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cp.setLoadSettings("unichem", &loadSettings{RefreshInterval: &refresh, NumberOfReplicas: &replicas})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The load crashed, the next one isn't resumed and has another plan
+	cp, err = OpenCheckpointStore(path, "other plan", partitions, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := cp.loadSettings("unichem")
+	if ls == nil || *ls.RefreshInterval != refresh || *ls.NumberOfReplicas != replicas {
+		t.Fatalf("got pending settings %+v, want the ones saved by the crashed load", ls)
+	}
+	if cp.loadSettings("other") != nil {
+		t.Error("settings of unichem taken for another index")
+	}
+
+	err = cp.setLoadSettings("unichem", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err = OpenCheckpointStore(path, "plan", partitions, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.loadSettings("unichem") != nil {
+		t.Error("restored settings still pending")
+	}
+}
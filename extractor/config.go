@@ -3,6 +3,10 @@ package extractor
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -14,29 +18,45 @@ type Range struct {
 
 //ElasticAuth ElasticSearch authentication
 type ElasticAuth struct {
-	Username, Password string
+	Username string `secret:"user"`
+	Password string `secret:"password"`
 }
 
 //Configuration stores the configuration parameters required for the application
 type Configuration struct {
-	LogPath         string
-	OracleConn      string
-	ElasticHost     string
-	MongoDB         string
-	BulkLimit       int
-	Index           string
-	Type            string
-	MaxBulkCalls    int
-	QueryMax        Range
-	Query           string
-	MaxConcurrent   int
-	Interval        int
-	MaxAttempts     int
-	ElasticAuth     ElasticAuth
-	ESIndexSettings string
-}
-
-//LoadConfig opening a yaml config file (config.yaml)
+	LogPath                 string
+	OracleConn              string `secret:"dsn"`
+	Driver                  string
+	DSN                     string `secret:"dsn"`
+	Files                   FlatFiles
+	SDF                     SDFMapping
+	Sink                    string
+	Export                  Export
+	ElasticHost             string `secret:"dsn"`
+	MongoDB                 string `secret:"dsn"`
+	MongoDatabase           string
+	MongoSourceCollection   string
+	MongoCompoundCollection string
+	BulkLimit               int
+	Index                   string
+	StatsIndex              string
+	Type                    string
+	MaxBulkCalls            int
+	QueryMax                Range
+	QueryRanges             []Range
+	Query                   string
+	MaxConcurrent           int
+	Interval                int
+	MaxAttempts             int
+	ElasticAuth             ElasticAuth
+	ESIndexSettings         string
+	Checkpoint              string
+	ShutdownTimeout         int
+	BlueGreen               BlueGreen
+}
+
+//LoadConfig opening a yaml config file (config.yaml), UNICHEM2INDEX_* environment
+//variables override its values
 func LoadConfig(c string) (*Configuration, error) {
 
 	var t Configuration
@@ -51,14 +71,292 @@ func LoadConfig(c string) (*Configuration, error) {
 	fmt.Printf("Using config path: %s \n", fn)
 
 	data, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) && len(c) == 0 {
+		// The whole configuration may come from the environment
+		fmt.Println("No config file found, using the environment only")
+	} else if err != nil {
+		return &t, err
+	}
+
+	// Unknown keys are most likely typos, they would be silently ignored otherwise
+	err = yaml.UnmarshalStrict(data, &t)
 	if err != nil {
 		return &t, err
 	}
 
-	err = yaml.Unmarshal(data, &t)
+	err = t.ApplyEnv()
 	if err != nil {
 		return &t, err
 	}
 
 	return &t, nil
 }
+
+//UsesDatabase whether UniChem is read through a database/sql driver, as opposed
+//to the flat-file dumps or an SD file
+func (c *Configuration) UsesDatabase() bool {
+	d := c.DBDriver()
+	return d != "files" && d != "sdf"
+}
+
+//Ranges UCI ranges to extract, queryranges when given otherwise querymax
+func (c *Configuration) Ranges() []Range {
+	if len(c.QueryRanges) > 0 {
+		return c.QueryRanges
+	}
+	return []Range{c.QueryMax}
+}
+
+//MongoDatabaseName database holding the sources and compounds collections
+func (c *Configuration) MongoDatabaseName() string {
+	if len(c.MongoDatabase) > 0 {
+		return c.MongoDatabase
+	}
+	return "ci_cache"
+}
+
+//MongoSourceCollectionName collection where LoadSources upserts the sources
+func (c *Configuration) MongoSourceCollectionName() string {
+	if len(c.MongoSourceCollection) > 0 {
+		return c.MongoSourceCollection
+	}
+	return "source"
+}
+
+//MongoCompoundCollectionName collection where the mongo sink upserts the compounds
+func (c *Configuration) MongoCompoundCollectionName() string {
+	if len(c.MongoCompoundCollection) > 0 {
+		return c.MongoCompoundCollection
+	}
+	return "compound"
+}
+
+//CheckpointPath where the checkpoint is kept, defaults to the log path
+func (c *Configuration) CheckpointPath() string {
+	if len(c.Checkpoint) > 0 {
+		return c.Checkpoint
+	}
+	return filepath.Join(c.LogPath, "unichem2index.checkpoint.json")
+}
+
+//IndexName the index the compounds are written to, or the alias of the
+//versioned indices on blue/green runs. unichem by default, index names are
+//always lowercase
+func (c *Configuration) IndexName() string {
+	if len(c.Index) > 0 {
+		return strings.ToLower(c.Index)
+	}
+	return "unichem"
+}
+
+//StatsIndexName the index the UCI counts by source are aggregated from when
+//loading the sources, the compounds one by default
+func (c *Configuration) StatsIndexName() string {
+	if len(c.StatsIndex) > 0 {
+		return strings.ToLower(c.StatsIndex)
+	}
+	return c.IndexName()
+}
+
+//IndexSettings the body indices are created with, esindexsettings or the
+//DefaultIndexSettings built into the binary when it's empty
+func (c *Configuration) IndexSettings() string {
+	if len(c.ESIndexSettings) > 0 {
+		return c.ESIndexSettings
+	}
+	return DefaultIndexSettings
+}
+
+//TypeName the document type sent along with the compounds, empty for typeless
+//indices (no type or _doc)
+func (c *Configuration) TypeName() string {
+	if c.Type == "_doc" {
+		return ""
+	}
+	return c.Type
+}
+
+//ShutdownTimeoutDuration how long batches already sent are waited for after a
+//SIGINT/SIGTERM, shutdowntimeout seconds or 20s by default
+func (c *Configuration) ShutdownTimeoutDuration() time.Duration {
+	if c.ShutdownTimeout > 0 {
+		return time.Duration(c.ShutdownTimeout) * time.Second
+	}
+	return 20 * time.Second
+}
+
+//SinkName where the compounds are written, defaults to elasticsearch
+func (c *Configuration) SinkName() string {
+	if len(c.Sink) > 0 {
+		return c.Sink
+	}
+	return "elasticsearch"
+}
+
+//DBDriver database/sql driver used to query UniChem, defaults to Oracle (godror)
+func (c *Configuration) DBDriver() string {
+	if len(c.Driver) > 0 {
+		return c.Driver
+	}
+	return "godror"
+}
+
+//DBConn connection string for the configured driver, falls back to OracleConn
+func (c *Configuration) DBConn() string {
+	if len(c.DSN) > 0 {
+		return c.DSN
+	}
+	return c.OracleConn
+}
+
+//RangeQuery the configured Query or, when empty, the built-in one for the driver.
+//Sources other than databases don't use a query
+func (c *Configuration) RangeQuery() (string, error) {
+	if !c.UsesDatabase() {
+		return "", nil
+	}
+	if len(c.Query) > 0 {
+		return c.Query, nil
+	}
+	d, err := getDialect(c.DBDriver())
+	if err != nil {
+		return "", err
+	}
+	return d.rangeQuery, nil
+}
+
+//renderQuery the RangeQuery for the given UCI range
+func (c *Configuration) renderQuery(start, finish int) (string, error) {
+	rq, err := c.RangeQuery()
+	if err != nil || len(rq) == 0 {
+		return rq, err
+	}
+	return fmt.Sprintf(rq, start, finish), nil
+}
+
+//ValidationError every problem found in a Configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+//Is a ValidationError matches ErrConfig
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrConfig
+}
+
+//ValidateSourcesLoad checks what the sources load needs on top of Validate, only
+//the commands loading the sources call it
+func (c *Configuration) ValidateSourcesLoad() error {
+	if c.SinkName() == "elasticsearch" && c.UsesDatabase() && len(c.MongoDB) <= 0 {
+		return &ValidationError{Problems: []string{"mongodb is required to load the sources after the extraction"}}
+	}
+	return nil
+}
+
+//Validate checks the configuration before anything connects, every problem
+//found is reported in a single ValidationError
+func (c *Configuration) Validate() error {
+	var p []string
+	add := func(format string, a ...interface{}) {
+		p = append(p, fmt.Sprintf(format, a...))
+	}
+
+	switch c.DBDriver() {
+	case "godror", "postgres":
+		if len(c.DBConn()) <= 0 {
+			add("a database connection string is required (dsn or oracleconn)")
+		}
+		if len(c.Query) > 0 {
+			q := strings.ReplaceAll(c.Query, "%%", "")
+			if strings.Count(q, "%d") != 2 || strings.Count(q, "%") != 2 {
+				add("query must have exactly two %%d placeholders, UCI start and finish, and no other verbs")
+			}
+		}
+	case "files":
+		if len(c.Files.Structures) <= 0 || len(c.Files.Xrefs) <= 0 || len(c.Files.Sources) <= 0 {
+			add("files structures, xrefs and sources paths are required by the files driver")
+		}
+	case "sdf":
+		if len(c.SDF.Path) <= 0 {
+			add("sdf path is required by the sdf driver")
+		}
+	default:
+		add("unknown driver %s, must be godror, postgres, files or sdf", c.DBDriver())
+	}
+
+	switch c.SinkName() {
+	case "elasticsearch", "opensearch":
+		if len(c.ElasticHost) <= 0 {
+			add("elastichost is required by the %s sink", c.SinkName())
+		}
+		if len(c.TypeName()) > 0 {
+			add("type %s can't be written to typeless indices (Elasticsearch 7 and later, OpenSearch), leave it out or set _doc", c.Type)
+		}
+		if len(c.ESIndexSettings) > 0 {
+			if m, err := configuredMapping(c.ESIndexSettings); err != nil {
+				add("esindexsettings is not valid JSON")
+			} else if len(mappingProperties(m)) == 0 {
+				add("esindexsettings has no mappings properties, leave it out to use the default index settings")
+			}
+		}
+	case "mongo":
+		if len(c.MongoDB) <= 0 {
+			add("mongodb is required by the mongo sink")
+		}
+	case "file", "parquet":
+		if len(c.Export.Path) <= 0 {
+			add("export path is required by the %s sink", c.SinkName())
+		}
+		if c.SinkName() == "file" && len(c.Export.Format) > 0 && c.Export.Format != "ndjson" && c.Export.Format != "bulk" {
+			add("unknown export format %s, must be ndjson or bulk", c.Export.Format)
+		}
+		if c.Export.Rotate < 0 {
+			add("export rotate must not be negative")
+		}
+	default:
+		add("unknown sink %s, must be elasticsearch, opensearch, mongo, file or parquet", c.SinkName())
+	}
+	if c.BlueGreen.Enabled && c.SinkName() != "elasticsearch" && c.SinkName() != "opensearch" {
+		add("bluegreen needs the elasticsearch or opensearch sink, not %s", c.SinkName())
+	}
+	if len(c.BlueGreen.Release) > 0 && !validRelease(c.BlueGreen.Release) {
+		add("bluegreen release %q must only hold letters, digits and underscores", c.BlueGreen.Release)
+	}
+	if c.BlueGreen.Keep < 0 {
+		add("bluegreen keep must not be negative")
+	}
+
+	if c.BulkLimit <= 0 {
+		add("bulklimit must be greater than 0")
+	}
+	if c.MaxBulkCalls <= 0 {
+		add("maxbulkcalls must be greater than 0")
+	}
+	if c.MaxConcurrent <= 0 {
+		add("maxconcurrent must be greater than 0")
+	}
+	if c.MaxAttempts <= 0 {
+		add("maxattempts must be greater than 0")
+	}
+	if c.Interval <= 0 {
+		add("interval must be greater than 0")
+	}
+
+	// The range is replaced in update mode, an empty querymax is only checked
+	// when extracting
+	if len(c.QueryRanges) > 0 || c.QueryMax != (Range{}) {
+		err := checkRanges(c.Ranges())
+		if err != nil {
+			add("query ranges: %s", err)
+		}
+	}
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
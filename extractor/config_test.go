@@ -0,0 +1,164 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateDocumentType(t *testing.T) {
+	for _, tc := range []struct {
+		sink, typ string
+		rejected  bool
+	}{
+		{"elasticsearch", "", false},
+		{"elasticsearch", "_doc", false},
+		{"elasticsearch", "Compound", true},
+		{"opensearch", "compound", true},
+		{"file", "compound", false},
+	} {
+		c := &Configuration{Sink: tc.sink, Type: tc.typ}
+		err := c.Validate()
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Fatalf("%s sink: got error %v, want a ValidationError", tc.sink, err)
+		}
+		rejected := strings.Contains(err.Error(), "typeless")
+		if rejected != tc.rejected {
+			t.Errorf("%s sink with type %q: rejected %t, want %t", tc.sink, tc.typ, rejected, tc.rejected)
+		}
+	}
+}
+
+func TestMongoOnlyRequiredToLoadSources(t *testing.T) {
+	c := &Configuration{
+		OracleConn:    "hr/hr@oradb:1521/xe",
+		ElasticHost:   "http://elasticsearch:9200",
+		Index:         "unichem",
+		QueryMax:      Range{Start: 1, Finish: 100},
+		Interval:      10,
+		BulkLimit:     100,
+		MaxBulkCalls:  2,
+		MaxConcurrent: 1,
+		MaxAttempts:   1,
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("configuration without mongodb rejected: %v", err)
+	}
+	if err := c.ValidateSourcesLoad(); err == nil || !strings.Contains(err.Error(), "mongodb") {
+		t.Errorf("got error %v, want mongodb required", err)
+	}
+	c.MongoDB = "mongodb://mongo:27017"
+	if err := c.ValidateSourcesLoad(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	err := ioutil.WriteFile(path, []byte("elastichost: http://file:9200\nindex: unichem\nbulklimit: 100\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "password")
+	if err = ioutil.WriteFile(secret, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("UNICHEM2INDEX_ELASTICHOST", "http://env:9200")
+	t.Setenv("UNICHEM2INDEX_BULKLIMIT", "500")
+	t.Setenv("UNICHEM2INDEX_ELASTICAUTH_PASSWORD_FILE", secret)
+	t.Setenv("UNICHEM2INDEX_QUERYMAX_FINISH", "300")
+	t.Setenv("UNICHEM2INDEX_QUERYRANGES", "[{start: 1, finish: 100}, {start: 200, finish: 300}]")
+	t.Setenv("UNICHEM2INDEX_FILES_STRUCTURECOLUMNS", "[uci, standardinchi]")
+	t.Setenv("UNICHEM2INDEX_SDF_SOURCES", "[{field: CHEMBL_ID, id: 1, name: chembl}]")
+	t.Setenv("UNICHEM2INDEX_BLUEGREEN_ENABLED", "true")
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ElasticHost != "http://env:9200" || c.BulkLimit != 500 || c.Index != "unichem" {
+		t.Errorf("got host %s, bulk limit %d and index %s, want the environment over the file", c.ElasticHost, c.BulkLimit, c.Index)
+	}
+	if c.ElasticAuth.Password != "s3cr3t" {
+		t.Errorf("got password %q, want the content of the _FILE without its new line", c.ElasticAuth.Password)
+	}
+	if c.QueryMax != (Range{Finish: 300}) {
+		t.Errorf("got querymax %+v, want the nested finish only", c.QueryMax)
+	}
+	if fmt.Sprint(c.QueryRanges) != "[{1 100} {200 300}]" {
+		t.Errorf("got queryranges %v", c.QueryRanges)
+	}
+	if fmt.Sprint(c.Files.StructureColumns) != "[uci standardinchi]" {
+		t.Errorf("got structure columns %v", c.Files.StructureColumns)
+	}
+	if len(c.SDF.Sources) != 1 || c.SDF.Sources[0] != (SDFSourceField{Field: "CHEMBL_ID", ID: 1, Name: "chembl"}) {
+		t.Errorf("got SD sources %+v", c.SDF.Sources)
+	}
+	if !c.BlueGreen.Enabled {
+		t.Error("bluegreen not enabled")
+	}
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(secret, []byte("s3cr3t"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"UNICHEM2INDEX_BULKLIMIT": "many"}, "UNICHEM2INDEX_BULKLIMIT"},
+		{map[string]string{"UNICHEM2INDEX_QUERYRANGES": "[{begin: 1, finish: 100}]"}, "UNICHEM2INDEX_QUERYRANGES"},
+		{map[string]string{
+			"UNICHEM2INDEX_ELASTICAUTH_PASSWORD":      "s3cr3t",
+			"UNICHEM2INDEX_ELASTICAUTH_PASSWORD_FILE": secret,
+		}, "both UNICHEM2INDEX_ELASTICAUTH_PASSWORD and UNICHEM2INDEX_ELASTICAUTH_PASSWORD_FILE are set"},
+		{map[string]string{"UNICHEM2INDEX_MONGODB_FILE": secret + ".missing"}, "UNICHEM2INDEX_MONGODB_FILE"},
+	} {
+		t.Run(tc.want, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			err := (&Configuration{}).ApplyEnv()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromTheEnvironmentOnly(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No config.yaml in the working directory
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	t.Setenv("UNICHEM2INDEX_ELASTICHOST", "http://env:9200")
+	t.Setenv("UNICHEM2INDEX_INTERVAL", "1000")
+	c, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ElasticHost != "http://env:9200" || c.Interval != 1000 {
+		t.Errorf("got host %s and interval %d, want the environment ones", c.ElasticHost, c.Interval)
+	}
+
+	// An explicit config file must exist
+	if _, err = LoadConfig("missing.yaml"); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want the missing config file", err)
+	}
+}
@@ -0,0 +1,101 @@
+package extractor
+
+import (
+	_ "embed"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultIndexSettings the index settings and mapping of the Compound documents
+// built into the binary, used when esindexsettings is empty. Sources are a plain
+// object, not nested, so the stats aggregations on sources.id count compounds
+//
+//go:embed defaultIndexSettings.json
+var DefaultIndexSettings string
+
+// fieldTypes the mapping types a Go kind can be indexed as
+var fieldTypes = map[reflect.Kind][]string{
+	reflect.String: {"keyword", "text"},
+	reflect.Int:    {"long", "integer"},
+	reflect.Int32:  {"long", "integer"},
+	reflect.Int64:  {"long"},
+	reflect.Bool:   {"boolean"},
+}
+
+// documentFields flattens the json tags of t into field path -> Go type, as the
+// documents are sent. Slices of structs are objects holding their fields
+func documentFields(t reflect.Type, prefix string, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		path := prefix + name
+		ft := f.Type
+		if ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		fields[path] = ft
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			documentFields(ft, path+".", fields)
+		}
+	}
+}
+
+// CheckDefaultIndexSettings compares the mapping of DefaultIndexSettings with the
+// json tags of Compound. It lists the fields sent but not mapped, mapped but never
+// sent, or mapped with a type their Go type can't be indexed as
+func CheckDefaultIndexSettings() ([]string, error) {
+	configured, err := configuredMapping(DefaultIndexSettings)
+	if err != nil {
+		return nil, err
+	}
+	mapped := map[string]string{}
+	mappingFields(mappingProperties(configured), "", mapped)
+	sent := map[string]reflect.Type{}
+	documentFields(reflect.TypeOf(Compound{}), "", sent)
+
+	var diff []string
+	for path, gt := range sent {
+		mt, ok := mapped[path]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s: %s sent, not mapped", path, gt))
+			continue
+		}
+		var want []string
+		switch {
+		case gt == reflect.TypeOf(time.Time{}):
+			want = []string{"date"}
+		case gt.Kind() == reflect.Struct:
+			want = []string{"object"}
+		default:
+			want = fieldTypes[gt.Kind()]
+		}
+		if !containsString(want, mt) {
+			diff = append(diff, fmt.Sprintf("%s: %s sent, mapped as %s", path, gt, mt))
+		}
+	}
+	for path := range mapped {
+		if _, ok := sent[path]; !ok {
+			diff = append(diff, fmt.Sprintf("%s: mapped, not a Compound field", path))
+		}
+	}
+	sort.Strings(diff)
+	return diff, nil
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
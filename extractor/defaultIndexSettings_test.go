@@ -0,0 +1,13 @@
+package extractor
+
+import "testing"
+
+func TestDefaultIndexSettingsMatchCompound(t *testing.T) {
+	diff, err := CheckDefaultIndexSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diff {
+		t.Error(d)
+	}
+}
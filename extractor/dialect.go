@@ -0,0 +1,216 @@
+package extractor
+
+import (
+	"fmt"
+	"time"
+)
+
+// dialect groups the built-in queries for each supported database driver, every
+// compound query selects the same 18 columns in the order read by sqlRows.Scan
+type dialect struct {
+	// rangeQuery takes the UCI start and finish (%d placeholders)
+	rangeQuery string
+	// removedSourcesQuery takes the date literal built by dateLiteral (%s placeholder)
+	removedSourcesQuery string
+	dateLiteral         func(t time.Time) string
+	countQuery          string
+	sourcesQuery        string
+	// limitQuery wraps a query (%s) returning at most a number of rows (%d)
+	limitQuery string
+}
+
+var dialects = map[string]dialect{
+	"godror":   oracleDialect,
+	"postgres": postgresDialect,
+}
+
+func getDialect(driver string) (dialect, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return dialect{}, fmt.Errorf("no queries available for driver %s", driver)
+	}
+	return d, nil
+}
+
+var oracleDialect = dialect{
+	rangeQuery: `
+SELECT ucpa.UCI,
+       ucpa.STANDARDINCHI,
+       ucpa.STANDARDINCHIKEY,
+       ucpa.PARENT_SMILES,
+       xref.SRC_COMPOUND_ID,
+       xref.ASSIGNMENT,
+       xref.CREATED,
+       xref.LASTUPDATED,
+       xref.AUX_SRC,
+       so.src_id,
+       so.NAME_LONG,
+       so.NAME_LABEL,
+       so.DESCRIPTION,
+       so.BASE_ID_URL,
+       so.NAME,
+       so.BASE_ID_URL_AVAILABLE,
+       so.AUX_FOR_URL,
+       so.PRIVATE
+FROM UC_XREF xref,
+     UC_SOURCE so,
+     (
+         SELECT UCI, STANDARDINCHI, STANDARDINCHIKEY, PARENT_SMILES
+         FROM UC_STRUCTURE
+         WHERE UCI >= %d
+           AND UCI < %d
+     ) ucpa
+WHERE xref.UCI = ucpa.UCI
+  AND xref.src_id = so.src_id
+ORDER BY ucpa.UCI`,
+	removedSourcesQuery: `
+SELECT ucpa.UCI,
+       ucpa.STANDARDINCHI,
+       ucpa.STANDARDINCHIKEY,
+       ucpa.PARENT_SMILES,
+       xref.SRC_COMPOUND_ID,
+       xref.ASSIGNMENT,
+       xref.CREATED,
+       xref.LASTUPDATED,
+       xref.AUX_SRC,
+       so.src_id,
+       so.NAME_LONG,
+       so.NAME_LABEL,
+       so.DESCRIPTION,
+       so.BASE_ID_URL,
+       so.NAME,
+       so.BASE_ID_URL_AVAILABLE,
+       so.AUX_FOR_URL,
+       so.PRIVATE
+FROM UC_XREF xref,
+     UC_SOURCE so,
+     UC_STRUCTURE ucpa
+WHERE xref.UCI in (
+    SELECT UCI
+    FROM UC_XREF
+    WHERE LASTUPDATED IS NOT NULL
+      AND LASTUPDATED >= %s
+)
+  AND xref.UCI = ucpa.UCI
+  AND xref.src_id = so.src_id
+ORDER BY ucpa.UCI`,
+	dateLiteral: func(t time.Time) string {
+		return fmt.Sprintf(`TO_DATE('%s', 'YYYYMMDD')`, t.Format("20060102"))
+	},
+	countQuery: `SELECT count(distinct(ucpa.UCI))
+				FROM
+				UC_XREF xref,
+				UC_SOURCE so,
+				UC_STRUCTURE ucpa
+				WHERE xref.UCI = ucpa.UCI
+				AND xref.src_id = so.src_id
+				ORDER BY ucpa.UCI`,
+	sourcesQuery: `
+SELECT so.SRC_ID,
+       so.NAME,
+       so.DESCRIPTION,
+       ur.SRC_RELEASE_NUMBER,
+       ur.SRC_RELEASE_DATE,
+       so.CREATED,
+       so.LAST_UPDATED,
+       so.NAME_LONG,
+       so.SRC_DETAILS,
+       so.SRC_URL,
+       so.BASE_ID_URL,
+       so.AUX_FOR_URL,
+       so.BASE_ID_URL_AVAILABLE,
+       so.PRIVATE,
+       so.NAME_LABEL,
+       so.UPDATE_COMMENTS
+FROM UC_SOURCE so,
+     UC_RELEASE ur
+WHERE so.CURRENT_RELEASE_U = ur.RELEASE_U
+AND so.SRC_ID = ur.SRC_ID
+ORDER BY so.SRC_ID`,
+	limitQuery: `SELECT * FROM (%s) WHERE ROWNUM <= %d`,
+}
+
+var postgresDialect = dialect{
+	rangeQuery: `
+SELECT ucpa.uci,
+       ucpa.standardinchi,
+       ucpa.standardinchikey,
+       COALESCE(ucpa.parent_smiles, ''),
+       COALESCE(xref.src_compound_id, ''),
+       xref.assignment,
+       xref.created,
+       xref.lastupdated,
+       COALESCE(xref.aux_src, ''),
+       so.src_id,
+       COALESCE(so.name_long, ''),
+       COALESCE(so.name_label, ''),
+       COALESCE(so.description, ''),
+       COALESCE(so.base_id_url, ''),
+       so.name,
+       so.base_id_url_available,
+       so.aux_for_url,
+       so.private
+FROM uc_structure ucpa
+         JOIN uc_xref xref ON xref.uci = ucpa.uci
+         JOIN uc_source so ON so.src_id = xref.src_id
+WHERE ucpa.uci >= %d
+  AND ucpa.uci < %d
+ORDER BY ucpa.uci`,
+	removedSourcesQuery: `
+SELECT ucpa.uci,
+       ucpa.standardinchi,
+       ucpa.standardinchikey,
+       COALESCE(ucpa.parent_smiles, ''),
+       COALESCE(xref.src_compound_id, ''),
+       xref.assignment,
+       xref.created,
+       xref.lastupdated,
+       COALESCE(xref.aux_src, ''),
+       so.src_id,
+       COALESCE(so.name_long, ''),
+       COALESCE(so.name_label, ''),
+       COALESCE(so.description, ''),
+       COALESCE(so.base_id_url, ''),
+       so.name,
+       so.base_id_url_available,
+       so.aux_for_url,
+       so.private
+FROM uc_structure ucpa
+         JOIN uc_xref xref ON xref.uci = ucpa.uci
+         JOIN uc_source so ON so.src_id = xref.src_id
+WHERE xref.uci IN (
+    SELECT uci
+    FROM uc_xref
+    WHERE lastupdated IS NOT NULL
+      AND lastupdated >= %s
+)
+ORDER BY ucpa.uci`,
+	dateLiteral: func(t time.Time) string {
+		return fmt.Sprintf(`DATE '%s'`, t.Format("2006-01-02"))
+	},
+	countQuery: `SELECT count(DISTINCT ucpa.uci)
+				FROM uc_structure ucpa
+				JOIN uc_xref xref ON xref.uci = ucpa.uci
+				JOIN uc_source so ON so.src_id = xref.src_id`,
+	sourcesQuery: `
+SELECT so.src_id,
+       so.name,
+       so.description,
+       ur.src_release_number,
+       ur.src_release_date,
+       so.created,
+       so.last_updated,
+       so.name_long,
+       so.src_details,
+       so.src_url,
+       so.base_id_url,
+       so.aux_for_url,
+       so.base_id_url_available,
+       so.private,
+       so.name_label,
+       so.update_comments
+FROM uc_source so
+         JOIN uc_release ur ON ur.release_u = so.current_release_u AND ur.src_id = so.src_id
+ORDER BY so.src_id`,
+	limitQuery: `SELECT * FROM (%s) limited LIMIT %d`,
+}
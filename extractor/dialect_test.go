@@ -0,0 +1,55 @@
+package extractor
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var coalesced = regexp.MustCompile(`(?i)^COALESCE\(([^,]+),.*\)$`)
+
+// selectColumns the lowercased columns of a query SELECT list, unwrapped from COALESCE
+func selectColumns(query string) []string {
+	q := strings.TrimSpace(query)
+	q = q[len("SELECT"):strings.Index(q, "\nFROM")]
+	var cols []string
+	for _, c := range strings.Split(q, ",\n") {
+		c = strings.TrimSpace(c)
+		if m := coalesced.FindStringSubmatch(c); m != nil {
+			c = m[1]
+		}
+		cols = append(cols, strings.ToLower(c))
+	}
+	return cols
+}
+
+func TestDialectsSelectTheSameColumns(t *testing.T) {
+	for name, d := range dialects {
+		for _, q := range []struct {
+			name, query, oracle string
+		}{
+			{"rangeQuery", d.rangeQuery, oracleDialect.rangeQuery},
+			{"removedSourcesQuery", d.removedSourcesQuery, oracleDialect.removedSourcesQuery},
+		} {
+			got, want := selectColumns(q.query), selectColumns(q.oracle)
+			if len(got) != rowColumns {
+				t.Errorf("%s %s selects %d columns, want %d", name, q.name, len(got), rowColumns)
+				continue
+			}
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s %s selects %v, want %v", name, q.name, got, want)
+			}
+		}
+	}
+}
+
+func TestPostgresNullableTextColumnsCoalesced(t *testing.T) {
+	for _, q := range []string{postgresDialect.rangeQuery, postgresDialect.removedSourcesQuery} {
+		for _, c := range []string{"ucpa.parent_smiles", "xref.src_compound_id", "xref.aux_src",
+			"so.name_long", "so.name_label", "so.description", "so.base_id_url"} {
+			if !strings.Contains(q, "COALESCE("+c+", '')") {
+				t.Errorf("%s not coalesced in %s", c, q)
+			}
+		}
+	}
+}
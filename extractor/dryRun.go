@@ -0,0 +1,129 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// dryRunRows rows fetched by each query checked in a dry run
+const dryRunRows = 1
+
+// DryRun prints the partitions an extraction would dispatch, checks every
+// partition query against the source and the index against the configured
+// mapping. Nothing is written to the sink, every problem found is returned
+func DryRun(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) error {
+	var problems []string
+	report := func(m string) {
+		fmt.Println(m)
+		l.Info(m)
+	}
+	fail := func(m string) {
+		problems = append(problems, m)
+		fmt.Println("FAIL", m)
+		l.Error(m)
+	}
+
+	partitions, err := planPartitions(conf)
+	if err != nil {
+		return err
+	}
+	report(fmt.Sprintf("DRY RUN %d partitions, %d extractors at a time", len(partitions), conf.MaxConcurrent))
+	for _, p := range partitions {
+		report(fmt.Sprintf("Partition ID: %d from %d to %d", p.ID, p.Start, p.Finish))
+	}
+
+	src, err := newRowSource(conf, l)
+	if err != nil {
+		return err
+	}
+	defer closeRowSource(l, src)
+
+	if s, ok := src.(*SQLSource); ok {
+		for _, p := range partitions {
+			err := s.checkQuery(ctx, p.Query, dryRunRows)
+			if err != nil {
+				fail(fmt.Sprintf("Partition ID: %d query: %s", p.ID, err))
+				continue
+			}
+			report(fmt.Sprintf("Partition ID: %d query OK", p.ID))
+		}
+	} else if len(partitions) > 0 {
+		// Files are read sequentially, checking the first partition is enough
+		err := checkRows(ctx, src, RowQuery{Start: partitions[0].Start, Finish: partitions[0].Finish})
+		if err != nil {
+			fail(fmt.Sprintf("Reading %s source: %s", conf.DBDriver(), err))
+		} else {
+			report(fmt.Sprintf("Reading %s source OK", conf.DBDriver()))
+		}
+	}
+
+	switch conf.SinkName() {
+	case "elasticsearch", "opensearch":
+		ip := checkIndex(ctx, conf, conf.IndexName())
+		for _, m := range ip {
+			fail(m)
+		}
+		if len(ip) == 0 {
+			report("Index OK")
+		}
+	default:
+		report(fmt.Sprintf("Nothing to check on the %s sink", conf.SinkName()))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("dry run found %d problems", len(problems))
+	}
+	report("DRY RUN OK, nothing was written")
+	return nil
+}
+
+// checkRows reads the first rows of a non database source
+func checkRows(ctx context.Context, src RowSource, q RowQuery) error {
+	rows, err := src.Rows(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var r Row
+	for i := 0; i < dryRunRows && rows.Next(); i++ {
+		err = rows.Scan(&r)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// checkIndex the index must have a mapping compatible with the configured one,
+// or not exist yet
+func checkIndex(ctx context.Context, conf *Configuration, index string) []string {
+	c := newRestClient(conf.ElasticHost, conf.ElasticAuth)
+	defer c.http.CloseIdleConnections()
+
+	live, err := c.getMapping(ctx, index)
+	if err != nil {
+		return []string{fmt.Sprintf("Fetching the %s mapping: %s", index, err)}
+	}
+	if live == nil {
+		fmt.Printf("Index %s doesn't exist, it would be created\n", index)
+		return nil
+	}
+
+	err = checkMappingDrift(ctx, conf, index)
+	var drift *MappingDriftError
+	if errors.As(err, &drift) {
+		var problems []string
+		for _, d := range drift.Fields {
+			problems = append(problems, fmt.Sprintf("Index %s mapping %s", index, d))
+		}
+		return problems
+	}
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
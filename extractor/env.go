@@ -0,0 +1,106 @@
+package extractor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix of the environment variables overriding the configuration
+const EnvPrefix = "UNICHEM2INDEX_"
+
+// ApplyEnv overrides the configuration with UNICHEM2INDEX_* environment variables.
+// Variables are named after the YAML keys, nested ones joined by an underscore:
+// UNICHEM2INDEX_ELASTICHOST, UNICHEM2INDEX_ELASTICAUTH_PASSWORD,
+// UNICHEM2INDEX_QUERYMAX_START. Lists take a YAML flow sequence, e.g.
+// UNICHEM2INDEX_QUERYRANGES='[{start: 1, finish: 100}]'. Every variable has a
+// _FILE variant reading the value from a file, as mounted by Kubernetes secrets
+func (c *Configuration) ApplyEnv() error {
+	var errs []string
+	applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, &errs)
+	if len(errs) > 0 {
+		return fmt.Errorf("environment overrides: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func applyEnv(v reflect.Value, prefix string, errs *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := prefix + strings.ToUpper(f.Name)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			applyEnv(fv, name+"_", errs)
+			continue
+		}
+
+		val, ok, err := lookupEnv(name)
+		if err != nil {
+			*errs = append(*errs, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		err = setField(fv, val)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+}
+
+// lookupEnv the value of name or, when name_FILE is set instead, the content of
+// that file without its trailing new line
+func lookupEnv(name string) (string, bool, error) {
+	val, ok := os.LookupEnv(name)
+	path, fok := os.LookupEnv(name + "_FILE")
+	if ok && fok {
+		return "", false, fmt.Errorf("both %s and %s_FILE are set", name, name)
+	}
+	if !fok {
+		return val, ok, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %s", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+func setField(fv reflect.Value, val string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Int:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	default:
+		n := reflect.New(fv.Type())
+		err := yaml.UnmarshalStrict([]byte(val), n.Interface())
+		if err != nil {
+			return err
+		}
+		fv.Set(n.Elem())
+	}
+	return nil
+}
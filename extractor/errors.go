@@ -0,0 +1,123 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInterrupted the run was stopped by a SIGINT or SIGTERM before finishing
+	ErrInterrupted = errors.New("extraction interrupted")
+	// ErrConfig the configuration can't be run, a ValidationError matches it too
+	ErrConfig = errors.New("invalid configuration")
+	// ErrSourceUnavailable the rows couldn't be read from the database or files
+	ErrSourceUnavailable = errors.New("source unavailable")
+	// ErrSinkUnavailable the sink couldn't be reached or set up
+	ErrSinkUnavailable = errors.New("sink unavailable")
+	// ErrSinkRejected the sink answered but refused some of the compounds
+	ErrSinkRejected = errors.New("sink rejected compounds")
+	// ErrInchiParse an InChI couldn't be split into its layers
+	ErrInchiParse = errors.New("InChI parse error")
+	// ErrCountMismatch the UCI count of the index doesn't match the database one
+	ErrCountMismatch = errors.New("index and database counts don't match")
+)
+
+// kindError tags an error with one of the sentinels, errors.Is matches both the
+// sentinel and the wrapped error
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return fmt.Sprintf("%s: %s", e.kind, e.err)
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// tagError wraps err with the kind sentinel, nil stays nil
+func tagError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// InchiError the InChI of a compound couldn't be split, it matches ErrInchiParse
+type InchiError struct {
+	UCI   int
+	Inchi string
+	Err   error
+}
+
+func (e *InchiError) Error() string {
+	return fmt.Sprintf("UCI %d InChI %s: %s", e.UCI, e.Inchi, e.Err)
+}
+
+func (e *InchiError) Unwrap() error {
+	return e.Err
+}
+
+func (e *InchiError) Is(target error) bool {
+	return target == ErrInchiParse
+}
+
+// RejectedError the items of a bulk refused by the sink, it matches ErrSinkRejected
+type RejectedError struct {
+	Items []FailedItem
+}
+
+func (e *RejectedError) Error() string {
+	if len(e.Items) == 0 {
+		return ErrSinkRejected.Error()
+	}
+	return fmt.Sprintf("%s: %d items, first %s: %s", ErrSinkRejected, len(e.Items), e.Items[0].ID, e.Items[0].Reason)
+}
+
+func (e *RejectedError) Is(target error) bool {
+	return target == ErrSinkRejected
+}
+
+// PartitionError the error of the last attempt of a partition
+type PartitionError struct {
+	ID, Start, Finish int
+	Err               error
+}
+
+func (e *PartitionError) Error() string {
+	return fmt.Sprintf("partition %d from %d to %d: %s", e.ID, e.Start, e.Finish, e.Err)
+}
+
+func (e *PartitionError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractionError the partitions that failed after every attempt, errors.Is
+// matches the error of any of them
+type ExtractionError struct {
+	Partitions []*PartitionError
+}
+
+func (e *ExtractionError) Error() string {
+	s := make([]string, len(e.Partitions))
+	for i, p := range e.Partitions {
+		s[i] = p.Error()
+	}
+	return fmt.Sprintf("%d partitions failed:\n  - %s", len(e.Partitions), strings.Join(s, "\n  - "))
+}
+
+func (e *ExtractionError) Is(target error) bool {
+	for _, p := range e.Partitions {
+		if errors.Is(p, target) {
+			return true
+		}
+	}
+	return false
+}
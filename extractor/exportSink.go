@@ -0,0 +1,220 @@
+package extractor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Export settings of the file sink. Format is either ndjson (one compound per
+// line) or bulk (Elasticsearch _bulk update/upsert pairs), every Rotate
+// compounds the current gzip file is closed and a new one started
+type Export struct {
+	Path   string
+	Format string
+	Rotate int
+}
+
+const defaultExportRotate = 100000
+
+type bulkAction struct {
+	Update bulkActionMeta `json:"update"`
+}
+
+type bulkActionMeta struct {
+	Index string `json:"_index"`
+	// Type only sent to indices with a custom document type
+	Type string `json:"_type,omitempty"`
+	ID   string `json:"_id"`
+}
+
+type bulkUpsert struct {
+	Doc         Compound `json:"doc"`
+	DocAsUpsert bool     `json:"doc_as_upsert"`
+}
+
+// FileSink writes compounds into gzip files instead of sending them over HTTP,
+// each closed file is reported as a WorkerResponse
+type FileSink struct {
+	logger    *zap.SugaredLogger
+	Dir       string
+	Format    string
+	IndexName string
+	// TypeName document type written on the bulk actions, none when empty
+	TypeName  string
+	Rotate    int
+	Partition string
+	part      int
+	count     int
+	lastID    string
+	tmpName   string
+	file      *os.File
+	gz        *gzip.Writer
+	w         *bufio.Writer
+	enc       *json.Encoder
+	sent      int64
+	respchan  chan WorkerResponse
+	errchan   chan error
+}
+
+// NewFileSink creates the export directory, files are named after the index and
+// the partition given
+func NewFileSink(l *zap.SugaredLogger, e Export, index, partition string) (*FileSink, error) {
+	format := e.Format
+	if len(format) == 0 {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "bulk" {
+		return nil, fmt.Errorf("unknown export format %s, must be ndjson or bulk", format)
+	}
+
+	rotate := e.Rotate
+	if rotate <= 0 {
+		rotate = defaultExportRotate
+	}
+
+	err := os.MkdirAll(e.Path, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{
+		logger:    l,
+		Dir:       e.Path,
+		Format:    format,
+		IndexName: index,
+		Rotate:    rotate,
+		Partition: partition,
+		respchan:  make(chan WorkerResponse),
+		errchan:   make(chan error),
+	}, nil
+}
+
+// Add writes the compound into the current file, rotating it when full
+func (fs *FileSink) Add(c Compound) error {
+	if fs.file == nil {
+		err := fs.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	id := strconv.Itoa(c.UCI)
+	var err error
+	if fs.Format == "bulk" {
+		err = fs.enc.Encode(bulkAction{Update: bulkActionMeta{Index: fs.IndexName, Type: fs.TypeName, ID: id}})
+		if err == nil {
+			err = fs.enc.Encode(bulkUpsert{Doc: c, DocAsUpsert: true})
+		}
+	} else {
+		err = fs.enc.Encode(c)
+	}
+	if err != nil {
+		return err
+	}
+
+	fs.count++
+	fs.lastID = id
+
+	if fs.count >= fs.Rotate {
+		return fs.Flush()
+	}
+	return nil
+}
+
+// Flush closes the current file and reports it
+func (fs *FileSink) Flush() error {
+	if fs.file == nil {
+		fs.logger.Warn("No compounds on current export file, skipping it")
+		return nil
+	}
+
+	batch := int(atomic.AddInt64(&fs.sent, 1))
+	name, err := fs.close(true)
+	if err != nil {
+		return err
+	}
+	fs.logger.Debugf("Export file %s written with %d compounds", name, fs.count)
+
+	fs.respchan <- WorkerResponse{
+		Succeeded:       fs.count,
+		Indexed:         fs.count,
+		Created:         fs.count,
+		LastSucceededID: fs.lastID,
+		Batch:           batch,
+	}
+	fs.count = 0
+	return nil
+}
+
+func (fs *FileSink) open() error {
+	fs.part++
+	name := fmt.Sprintf("%s-%s-%05d.%s.gz", fs.IndexName, fs.Partition, fs.part, fs.Format)
+	fs.tmpName = filepath.Join(fs.Dir, name+".tmp")
+
+	f, err := os.Create(fs.tmpName)
+	if err != nil {
+		return err
+	}
+	fs.file = f
+	fs.gz = gzip.NewWriter(f)
+	fs.w = bufio.NewWriter(fs.gz)
+	fs.enc = json.NewEncoder(fs.w)
+	return nil
+}
+
+// close finishes the current file and, when complete, moves it to its final
+// name. Partially written files keep their .tmp suffix
+func (fs *FileSink) close(complete bool) (string, error) {
+	f := fs.file
+	fs.file = nil
+
+	err := fs.w.Flush()
+	if err == nil {
+		err = fs.gz.Close()
+	}
+	if e := f.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil || !complete {
+		return fs.tmpName, err
+	}
+
+	name := fs.tmpName[:len(fs.tmpName)-len(".tmp")]
+	return name, os.Rename(fs.tmpName, name)
+}
+
+// Close closes any file left open without a Flush, it keeps its .tmp suffix
+func (fs *FileSink) Close() error {
+	if fs.file == nil {
+		return nil
+	}
+	name, err := fs.close(false)
+	fs.logger.Warnf("Export file %s left incomplete", name)
+	return err
+}
+
+// Responses channel where every written file is reported
+func (fs *FileSink) Responses() <-chan WorkerResponse {
+	return fs.respchan
+}
+
+// Errors never used, write errors are returned by Add and Flush
+func (fs *FileSink) Errors() <-chan error {
+	return fs.errchan
+}
+
+// Sent number of files finished
+func (fs *FileSink) Sent() int {
+	return int(atomic.LoadInt64(&fs.sent))
+}
+
+// Wait files are written synchronously, nothing to wait for
+func (fs *FileSink) Wait() {}
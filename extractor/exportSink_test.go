@@ -0,0 +1,186 @@
+package extractor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// gzipLines the lines of a gzip file
+func gzipLines(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	sc := bufio.NewScanner(gz)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err = sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+// dirFiles the names of the files in dir, sorted
+func dirFiles(t *testing.T, dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectResponses the responses of s, until it's closed
+func collectResponses(s Sink) <-chan []WorkerResponse {
+	done := make(chan []WorkerResponse)
+	go func() {
+		var wrs []WorkerResponse
+		for wr := range s.Responses() {
+			wrs = append(wrs, wr)
+		}
+		done <- wrs
+	}()
+	return done
+}
+
+func TestFileSinkRotatesFiles(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileSink(zap.NewNop().Sugar(), Export{Path: dir, Rotate: 2}, "unichem", "1-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := collectResponses(fs)
+
+	for uci := 1; uci <= 3; uci++ {
+		if err = fs.Add(Compound{UCI: uci}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = fs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(fs.respchan)
+
+	want := []string{"unichem-1-4-00001.ndjson.gz", "unichem-1-4-00002.ndjson.gz"}
+	if got := dirFiles(t, dir); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got files %v, want %v", got, want)
+	}
+
+	var ucis []int
+	for _, name := range want {
+		for _, line := range gzipLines(t, filepath.Join(dir, name)) {
+			var c Compound
+			if err = json.Unmarshal([]byte(line), &c); err != nil {
+				t.Fatalf("%s: line %s: %v", name, line, err)
+			}
+			ucis = append(ucis, c.UCI)
+		}
+	}
+	if len(ucis) != 3 || ucis[0] != 1 || ucis[1] != 2 || ucis[2] != 3 {
+		t.Errorf("got compounds %v, want 1, 2 and 3 one per line", ucis)
+	}
+
+	wrs := <-responses
+	if len(wrs) != 2 || wrs[0].Indexed != 2 || wrs[0].LastSucceededID != "2" || wrs[1].Indexed != 1 || wrs[1].LastSucceededID != "3" {
+		t.Errorf("got responses %+v, want one per file", wrs)
+	}
+	if fs.Sent() != 2 {
+		t.Errorf("got %d files sent, want 2", fs.Sent())
+	}
+}
+
+func TestFileSinkBulkFormat(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileSink(zap.NewNop().Sugar(), Export{Path: dir, Format: "bulk"}, "unichem", "1-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.TypeName = "compound"
+	responses := collectResponses(fs)
+
+	for uci := 1; uci <= 2; uci++ {
+		if err = fs.Add(Compound{UCI: uci}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = fs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	close(fs.respchan)
+	<-responses
+
+	want := []string{
+		`{"update":{"_index":"unichem","_type":"compound","_id":"1"}}`,
+		`{"update":{"_index":"unichem","_type":"compound","_id":"2"}}`,
+	}
+	lines := gzipLines(t, filepath.Join(dir, "unichem-1-3-00001.bulk.gz"))
+	if len(lines) != 4 {
+		t.Fatalf("got lines %q, want an update and its upsert per compound", lines)
+	}
+	for i, w := range want {
+		if lines[2*i] != w {
+			t.Errorf("got action %s, want %s", lines[2*i], w)
+		}
+		var upsert bulkUpsert
+		if err = json.Unmarshal([]byte(lines[2*i+1]), &upsert); err != nil {
+			t.Fatal(err)
+		}
+		if !upsert.DocAsUpsert || upsert.Doc.UCI != i+1 {
+			t.Errorf("got upsert %s, want compound %d as upsert", lines[2*i+1], i+1)
+		}
+	}
+}
+
+func TestFileSinkLeavesUnflushedFilesTemporary(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileSink(zap.NewNop().Sugar(), Export{Path: dir}, "unichem", "1-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Add(Compound{UCI: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirFiles(t, dir); len(got) != 1 || got[0] != "unichem-1-3-00001.ndjson.gz.tmp" {
+		t.Errorf("got files %v while writing, want the .tmp one", got)
+	}
+
+	// Interrupted before the Flush
+	if err = fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirFiles(t, dir); len(got) != 1 || got[0] != "unichem-1-3-00001.ndjson.gz.tmp" {
+		t.Errorf("got files %v, want the .tmp one left", got)
+	}
+	if fs.Sent() != 0 {
+		t.Errorf("got %d files sent, want none", fs.Sent())
+	}
+}
+
+func TestFileSinkUnknownFormat(t *testing.T) {
+	_, err := NewFileSink(zap.NewNop().Sugar(), Export{Path: t.TempDir(), Format: "csv"}, "unichem", "1-3")
+	if err == nil {
+		t.Error("csv format accepted")
+	}
+}
@@ -2,61 +2,50 @@ package extractor
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
+	"io"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-//Extractor connects to the given oracle string connection (Oraconn), fetch
-//the unichem data and adds it into the index using the ElasticManager provided
+//Extractor fetches the unichem data from the given RowSource (Source) and adds
+//it into the given Sink
 type Extractor struct {
 	id                     int
-	ElasticManager         *ElasticManager
-	Oraconn                string
+	Sink                   Sink
+	Source                 RowSource
 	Query                  string
 	QueryLimit, QueryStart int
 	Logger                 *zap.SugaredLogger
 	LastIDAdded            int
-	db                     *sql.DB
 	exerror                chan error
 	inFinish               chan int
 	Attemps                int
+	// checkpoint records the UCIs confirmed by the Sink, nil when not kept
+	checkpoint *CheckpointStore
+	// sinks opens the Sink of every attempt
+	sinks SinkFactory
+	// tracker gathers the outcome of the partition for the run result
+	tracker *runTracker
+	// console progress and errors are printed on, nil when quiet
+	console io.Writer
 	//CurrentCompound contains the current compound being added to the loader
 	PreviousCompound Compound
 	CurrentCompound  Compound
 }
 
-// Start extracting UniChem data by querying UniChem's db
-// and adds them into the index using a provided ElasticManager
+// Start extracting UniChem data by querying the extractor's RowSource
+// and adds them into the provided Sink
 func (ex *Extractor) Start(ctx context.Context) error {
 	ex.PreviousCompound = Compound{UCI: 0}
 	ex.CurrentCompound = Compound{UCI: 0}
 
 	logger := ex.Logger
 
-	var err error
-
 	logger.Infof("Fetching from:%d to %d", ex.QueryStart, ex.QueryLimit)
 
-	ex.db, err = sql.Open("godror", ex.Oraconn)
-	if err != nil {
-		ex.exerror <- err
-		logger.Error("Go oracle open ERROR ", err)
-		return err
-	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			m := fmt.Sprint("Go oracle Closing DB ", err)
-			fmt.Println(m)
-			logger.Error(m)
-		}
-	}(ex.db)
-	logger.Info("Success connecting to Oracle DB")
-
-	err = ex.queryByOneWithSources(ctx)
+	err := ex.queryByOneWithSources(ctx)
 	if err != nil {
 		ex.exerror <- err
 		return err
@@ -68,138 +57,109 @@ func (ex *Extractor) Start(ctx context.Context) error {
 func (ex *Extractor) queryByOneWithSources(ctx context.Context) error {
 	logger := ex.Logger
 
-	var (
-		UCI, srcID, assignment, srcPrivate, srcBaseIDURLAvailable, srcAuxForURL       int
-		standardInchi, standardInchiKey, smiles, auxSrc                               string
-		srcCompoundID, srcNameLong, srcName, srcDescription, srcBaseURL, srcShortName string
-		lastUpdated                                                                   sql.NullTime
-		created                                                                       time.Time
-	)
-
 	logger.Debug("Query: ", ex.Query)
 
-	rows, err := ex.db.QueryContext(ctx, ex.Query)
+	rows, err := ex.Source.Rows(ctx, RowQuery{
+		Start:  ex.QueryStart,
+		Finish: ex.QueryLimit,
+		SQL:    ex.Query,
+	})
 	if err != nil {
 		logger.Error("Error running query ", err)
-		return err
+		return tagError(ErrSourceUnavailable, err)
 	}
 	defer rows.Close()
 
 	logger.Infof("Success, got rows from extractor %d started on %d", ex.id, ex.QueryStart)
-	var c Compound
-l:
+	var r Row
 	for rows.Next() {
 
-		select {
-		case <-ctx.Done():
-			logger.Warnf("Interrumping extractor %d because of context done", ex.id)
-			break l
-		default:
+		if ctx.Err() != nil {
+			break
 		}
 
-		err := rows.Scan(
-			&UCI,
-			&standardInchi,
-			&standardInchiKey,
-			&smiles,
-			&srcCompoundID,
-			&assignment,
-			&created,
-			&lastUpdated,
-			&auxSrc,
-			&srcID,
-			&srcNameLong,
-			&srcName,
-			&srcDescription,
-			&srcBaseURL,
-			&srcShortName,
-			&srcBaseIDURLAvailable,
-			&srcAuxForURL,
-			&srcPrivate)
+		err := rows.Scan(&r)
 		if err != nil {
 			logger.Error(err, "Error reading line")
-			return err
-		}
-		//logger.Debugw(
-		//	"Row:",
-		//	"UCI", UCI,
-		//	"standarInchi", standardInchi,
-		//	"standarInchiKey", standardInchiKey,
-		//	"smiles", smiles,
-		//	"srcCompoundID", srcCompoundID,
-		//	"srcID", srcID,
-		//	"srcName", srcName,
-		//)
-
-		i := *new(Inchi)
-		if len(standardInchi) == 0 {
-			logger.Debugf("Compound (%d) without InChI key, skipping split", UCI)
-		} else {
-			i.Inchi = standardInchi
-		}
-
-		isPrivate := false
-		if srcPrivate == 1 {
-			isPrivate = true
+			return tagError(ErrSourceUnavailable, err)
 		}
 
-		isBaseIDURLAvailable := false
-		if srcBaseIDURLAvailable == 1 {
-			isBaseIDURLAvailable = true
-		}
-
-		hasAuxForURL := false
-		if srcAuxForURL == 1 {
-			hasAuxForURL = true
-		}
-		c = Compound{
-			UCI:              UCI,
-			Inchi:            i,
-			StandardInchiKey: standardInchiKey,
-			Smiles:           smiles,
-			CreatedAt:        time.Now(),
-			IsSourceless:     false,
-		}
-		ex.CurrentCompound = c
-
-		var l time.Time
-		if lastUpdated.Valid {
-			l = lastUpdated.Time
+		err = ex.addRow(r)
+		if err != nil {
+			return err
 		}
-
-		ex.addSourceToCompound(CompoundSource{
-			ID:                 srcID,
-			Name:               srcName,
-			LongName:           srcNameLong,
-			CompoundID:         srcCompoundID,
-			Description:        srcDescription,
-			BaseURL:            srcBaseURL,
-			ShortName:          srcShortName,
-			BaseIDURLAvailable: isBaseIDURLAvailable,
-			AuxSrc:             auxSrc,
-			AuxForURL:          hasAuxForURL,
-			CreatedAt:          created,
-			LastUpdate:         l,
-			IsPrivate:          isPrivate,
-		}, assignment)
-
+	}
+	if err := ctx.Err(); err != nil {
+		// The compound being read may still miss some of its sources, it's left
+		// unsent for the next run rather than upserted incomplete
+		logger.Warnf("Interrumping extractor %d because of context done, UCI %d not sent", ex.id, ex.PreviousCompound.UCI)
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(err, "Error iterating rows")
+		return tagError(ErrSourceUnavailable, err)
 	}
 
 	if ex.PreviousCompound.UCI != 0 {
-		ex.addPreviousCompoundToBulk()
+		err = ex.addPreviousCompoundToBulk()
+		if err != nil {
+			return err
+		}
 	} else {
 		logger.Warn("PREVIOUS COMPOUND EMPTY! Worker had nothing to work with")
 	}
 
 	logger.Infof("Sending last bulk for extractor started on %d", ex.QueryStart)
-	ex.ElasticManager.SendCurrentBulk()
+	err = ex.Sink.Flush()
+	if err != nil {
+		logger.Error("Error sending last bulk ", err)
+		return err
+	}
 
 	ex.inFinish <- 1
 	logger.Debug("1 to channel inFinish ")
 	return nil
 }
 
-func (ex *Extractor) addSourceToCompound(source CompoundSource, assignment int) {
+// addRow turns a Row into its Compound and CompoundSource and groups it with
+// the previous rows sharing the same UCI
+func (ex *Extractor) addRow(r Row) error {
+	logger := ex.Logger
+
+	i := *new(Inchi)
+	if len(r.StandardInchi) == 0 {
+		logger.Debugf("Compound (%d) without InChI key, skipping split", r.UCI)
+	} else {
+		i.Inchi = r.StandardInchi
+	}
+
+	ex.CurrentCompound = Compound{
+		UCI:              r.UCI,
+		Inchi:            i,
+		StandardInchiKey: r.StandardInchiKey,
+		Smiles:           r.Smiles,
+		CreatedAt:        time.Now(),
+		IsSourceless:     false,
+	}
+
+	return ex.addSourceToCompound(CompoundSource{
+		ID:                 r.SrcID,
+		Name:               r.SrcName,
+		LongName:           r.SrcNameLong,
+		CompoundID:         r.SrcCompoundID,
+		Description:        r.SrcDescription,
+		BaseURL:            r.SrcBaseURL,
+		ShortName:          r.SrcShortName,
+		BaseIDURLAvailable: r.SrcBaseIDURLAvailable == 1,
+		AuxSrc:             r.AuxSrc,
+		AuxForURL:          r.SrcAuxForURL == 1,
+		CreatedAt:          r.Created,
+		LastUpdate:         r.LastUpdated,
+		IsPrivate:          r.SrcPrivate == 1,
+	}, r.Assignment)
+}
+
+func (ex *Extractor) addSourceToCompound(source CompoundSource, assignment int) error {
 	logger := ex.Logger
 
 	logger.Debugf("Found UCI <%d> Source ID %d Name %s", ex.CurrentCompound.UCI, source.ID, source.Name)
@@ -209,12 +169,15 @@ func (ex *Extractor) addSourceToCompound(source CompoundSource, assignment int)
 			ex.CurrentCompound.Sources = append(ex.CurrentCompound.Sources, source)
 		}
 		ex.PreviousCompound = ex.CurrentCompound
-		return
+		return nil
 	}
 
 	if ex.PreviousCompound.UCI != ex.CurrentCompound.UCI {
 		logger.Debugf("New compound UCI <%d> adding previous one <%d> to index", ex.CurrentCompound.UCI, ex.PreviousCompound.UCI)
-		ex.addPreviousCompoundToBulk()
+		err := ex.addPreviousCompoundToBulk()
+		if err != nil {
+			return err
+		}
 
 		if assignment == 1 {
 			ex.CurrentCompound.Sources = append(ex.CurrentCompound.Sources, source)
@@ -225,9 +188,10 @@ func (ex *Extractor) addSourceToCompound(source CompoundSource, assignment int)
 			ex.PreviousCompound.Sources = append(ex.PreviousCompound.Sources, source)
 		}
 	}
+	return nil
 }
 
-func (ex *Extractor) addPreviousCompoundToBulk() {
+func (ex *Extractor) addPreviousCompoundToBulk() error {
 	logger := ex.Logger
 	var err error
 	if len(ex.PreviousCompound.Sources) <= 0 {
@@ -241,11 +205,11 @@ func (ex *Extractor) addPreviousCompoundToBulk() {
 		c, err = inDi.ProcessInchi(ex.PreviousCompound)
 		if err != nil {
 			m := fmt.Sprintf("Split InChI error in UCI: %d ", ex.PreviousCompound.UCI)
-			fmt.Println(m, err)
-			logger.Panic(m, err)
-			panic(err)
+			printConsole(ex.console, fmt.Sprint(m, err))
+			logger.Error(m, err)
+			return &InchiError{UCI: ex.PreviousCompound.UCI, Inchi: ex.PreviousCompound.Inchi.Inchi, Err: err}
 		}
 	}
 
-	ex.ElasticManager.AddToBulk(c)
+	return ex.Sink.Add(c)
 }
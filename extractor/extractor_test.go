@@ -0,0 +1,203 @@
+package extractor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeRowSource serves the rows within the requested UCI range, in the order
+// given. cancel, when set, is called once cancelAt rows have been read
+type fakeRowSource struct {
+	rows     []Row
+	cancel   context.CancelFunc
+	cancelAt int
+}
+
+func (s *fakeRowSource) Rows(ctx context.Context, q RowQuery) (RowIterator, error) {
+	var rows []Row
+	for _, r := range s.rows {
+		if r.UCI >= q.Start && (q.Finish == 0 || r.UCI < q.Finish) {
+			rows = append(rows, r)
+		}
+	}
+	return &fakeRowIterator{rows: rows, i: -1, cancel: s.cancel, cancelAt: s.cancelAt}, nil
+}
+
+func (s *fakeRowSource) Close() error {
+	return nil
+}
+
+type fakeRowIterator struct {
+	rows     []Row
+	i        int
+	cancel   context.CancelFunc
+	cancelAt int
+}
+
+func (it *fakeRowIterator) Next() bool {
+	it.i++
+	if it.cancel != nil && it.i == it.cancelAt {
+		it.cancel()
+	}
+	return it.i < len(it.rows)
+}
+
+func (it *fakeRowIterator) Scan(r *Row) error {
+	*r = it.rows[it.i]
+	return nil
+}
+
+func (it *fakeRowIterator) Err() error {
+	return nil
+}
+
+func (it *fakeRowIterator) Close() error {
+	return nil
+}
+
+// fakeSink keeps the compounds added and the number of flushes
+type fakeSink struct {
+	added   []Compound
+	flushes int
+}
+
+func (s *fakeSink) Add(c Compound) error {
+	s.added = append(s.added, c)
+	return nil
+}
+
+func (s *fakeSink) Flush() error {
+	s.flushes++
+	return nil
+}
+
+func (s *fakeSink) Close() error                     { return nil }
+func (s *fakeSink) Responses() <-chan WorkerResponse { return nil }
+func (s *fakeSink) Errors() <-chan error             { return nil }
+func (s *fakeSink) Sent() int                        { return 0 }
+func (s *fakeSink) Wait()                            {}
+
+func sourceIDs(c Compound) []int {
+	var ids []int
+	for _, s := range c.Sources {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func TestExtractorGroupsRowsByUCI(t *testing.T) {
+	src := &fakeRowSource{rows: []Row{
+		{UCI: 1, StandardInchi: "InChI=1S/CH4/h1H4", StandardInchiKey: "VNWKTOKETHGBQD-UHFFFAOYSA-N", SrcID: 1, Assignment: 1},
+		{UCI: 1, StandardInchi: "InChI=1S/CH4/h1H4", StandardInchiKey: "VNWKTOKETHGBQD-UHFFFAOYSA-N", SrcID: 2, Assignment: 1},
+		{UCI: 2, SrcID: 3, Assignment: 1},
+		{UCI: 3, SrcID: 4, Assignment: 0},
+		{UCI: 4, SrcID: 5, Assignment: 1},
+		{UCI: 4, SrcID: 6, Assignment: 1},
+	}}
+	sink := &fakeSink{}
+	ex := Extractor{
+		Sink:       sink,
+		Source:     src,
+		QueryStart: 1,
+		QueryLimit: 10,
+		Logger:     zap.NewNop().Sugar(),
+		inFinish:   make(chan int, 1),
+	}
+
+	err := ex.queryByOneWithSources(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		uci        int
+		sources    []int
+		sourceless bool
+	}{
+		{uci: 1, sources: []int{1, 2}},
+		{uci: 2, sources: []int{3}},
+		{uci: 3, sourceless: true},
+		{uci: 4, sources: []int{5, 6}},
+	}
+	if len(sink.added) != len(want) {
+		t.Fatalf("got %d compounds, want %d", len(sink.added), len(want))
+	}
+	for i, w := range want {
+		c := sink.added[i]
+		if c.UCI != w.uci {
+			t.Errorf("compound %d: UCI %d, want %d", i, c.UCI, w.uci)
+		}
+		if !reflect.DeepEqual(sourceIDs(c), w.sources) {
+			t.Errorf("UCI %d: sources %v, want %v", c.UCI, sourceIDs(c), w.sources)
+		}
+		if c.IsSourceless != w.sourceless {
+			t.Errorf("UCI %d: sourceless %t, want %t", c.UCI, c.IsSourceless, w.sourceless)
+		}
+	}
+	if sink.added[0].Inchi.Formula != "CH4" {
+		t.Errorf("UCI 1: InChI not split, formula %q", sink.added[0].Inchi.Formula)
+	}
+	if sink.flushes != 1 {
+		t.Errorf("got %d flushes, want 1", sink.flushes)
+	}
+	if len(ex.inFinish) != 1 {
+		t.Error("extractor didn't report its end")
+	}
+}
+
+func TestExtractorWithoutRows(t *testing.T) {
+	sink := &fakeSink{}
+	ex := Extractor{
+		Sink:       sink,
+		Source:     &fakeRowSource{},
+		QueryStart: 1,
+		QueryLimit: 10,
+		Logger:     zap.NewNop().Sugar(),
+		inFinish:   make(chan int, 1),
+	}
+
+	err := ex.queryByOneWithSources(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.added) != 0 {
+		t.Errorf("got %d compounds from no rows", len(sink.added))
+	}
+}
+
+func TestExtractorCanceledLeavesTheCurrentCompound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Canceled while UCI 2 still has a source to read
+	src := &fakeRowSource{rows: []Row{
+		{UCI: 1, SrcID: 1, Assignment: 1},
+		{UCI: 2, SrcID: 1, Assignment: 1},
+		{UCI: 2, SrcID: 2, Assignment: 1},
+	}, cancel: cancel, cancelAt: 2}
+	sink := &fakeSink{}
+	ex := Extractor{
+		Sink:       sink,
+		Source:     src,
+		QueryStart: 1,
+		QueryLimit: 10,
+		Logger:     zap.NewNop().Sugar(),
+		inFinish:   make(chan int, 1),
+	}
+
+	err := ex.queryByOneWithSources(ctx)
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if len(sink.added) != 1 || sink.added[0].UCI != 1 {
+		t.Errorf("got %d compounds, want only UCI 1", len(sink.added))
+	}
+	if sink.flushes != 0 {
+		t.Errorf("got %d flushes after the cancellation", sink.flushes)
+	}
+	if len(ex.inFinish) != 0 {
+		t.Error("canceled extractor reported its end")
+	}
+}
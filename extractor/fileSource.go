@@ -0,0 +1,413 @@
+package extractor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FlatFiles location and layout of the UniChem flat-file dumps. Structures and
+// xrefs must be sorted by UCI, files ending in .gz are decompressed on the fly.
+// When the columns of a file are not given its first line is read as the header.
+// Fields are split on Separator, "|" as in the alter/spool*.sql exports by
+// default, with no quoting: quotes are kept as part of the field
+type FlatFiles struct {
+	Structures       string
+	Xrefs            string
+	Sources          string
+	Separator        string
+	StructureColumns []string
+	XrefColumns      []string
+	SourceColumns    []string
+}
+
+const defaultFlatFileSeparator = "|"
+
+var flatFileDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"02-Jan-06",
+	"02-JAN-06",
+	"20060102",
+}
+
+// FileSource is a RowSource reading the UniChem structure, xref and source dumps,
+// rows are built by joining the three files by UCI and source ID. Every Rows call
+// reads the structures and xrefs from the start of the files up to its range
+type FileSource struct {
+	files   FlatFiles
+	sources map[int]Row
+	logger  *zap.SugaredLogger
+}
+
+// NewFileSource loads the sources file and checks the structure and xref files
+// can be opened, xrefs of unknown sources are reported to l
+func NewFileSource(files FlatFiles, l *zap.SugaredLogger) (*FileSource, error) {
+	fs := &FileSource{
+		files:   files,
+		sources: make(map[int]Row),
+		logger:  l,
+	}
+	if fs.logger == nil {
+		fs.logger = zap.NewNop().Sugar()
+	}
+
+	for _, p := range []string{files.Structures, files.Xrefs} {
+		if _, err := os.Stat(p); err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := fs.openTable(files.Sources, files.SourceColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	for {
+		rec, err := t.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		srcID, err := t.getInt(rec, "src_id")
+		if err != nil {
+			return nil, err
+		}
+		fs.sources[srcID] = Row{
+			SrcID:                 srcID,
+			SrcNameLong:           t.get(rec, "name_long"),
+			SrcName:               t.get(rec, "name_label"),
+			SrcDescription:        t.get(rec, "description"),
+			SrcBaseURL:            t.get(rec, "base_id_url"),
+			SrcShortName:          t.get(rec, "name"),
+			SrcBaseIDURLAvailable: t.getFlag(rec, "base_id_url_available"),
+			SrcAuxForURL:          t.getFlag(rec, "aux_for_url"),
+			SrcPrivate:            t.getFlag(rec, "private"),
+		}
+	}
+
+	return fs, nil
+}
+
+// Rows reads the xrefs within the RowQuery UCI range joined to their structure
+// and source. Every call reads the files from the beginning
+func (fs *FileSource) Rows(ctx context.Context, q RowQuery) (RowIterator, error) {
+	structures, err := fs.openTable(fs.files.Structures, fs.files.StructureColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	xrefs, err := fs.openTable(fs.files.Xrefs, fs.files.XrefColumns)
+	if err != nil {
+		_ = structures.Close()
+		return nil, err
+	}
+
+	return &fileRows{
+		ctx:        ctx,
+		query:      q,
+		logger:     fs.logger,
+		sources:    fs.sources,
+		structures: structures,
+		xrefs:      xrefs,
+	}, nil
+}
+
+// Close nothing to release, files are closed with their RowIterator
+func (fs *FileSource) Close() error {
+	return nil
+}
+
+func (fs *FileSource) openTable(path string, columns []string) (*flatTable, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("flat file path can't be empty")
+	}
+
+	r, err := openDump(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &flatTable{path: path, file: r, reader: bufio.NewReader(r), separator: fs.files.Separator}
+	if len(t.separator) == 0 {
+		t.separator = defaultFlatFileSeparator
+	}
+
+	if len(columns) == 0 {
+		columns, err = t.read()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			_ = t.Close()
+			return nil, fmt.Errorf("%s: reading header: %w", path, err)
+		}
+	}
+	t.columns = make(map[string]int, len(columns))
+	for i, c := range columns {
+		t.columns[strings.ToLower(strings.TrimSpace(c))] = i
+	}
+
+	return t, nil
+}
+
+type flatTable struct {
+	path      string
+	file      io.ReadCloser
+	reader    *bufio.Reader
+	separator string
+	columns   map[string]int
+}
+
+// read the fields of the next non empty line, lines have no length limit
+func (t *flatTable) read() ([]string, error) {
+	for {
+		line, err := t.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", t.path, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(strings.TrimSpace(line)) > 0 {
+			return strings.Split(line, t.separator), nil
+		}
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+	}
+}
+
+func (t *flatTable) get(rec []string, col string) string {
+	i, ok := t.columns[col]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func (t *flatTable) getInt(rec []string, col string) (int, error) {
+	v := t.get(rec, col)
+	if len(v) == 0 {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: column %s: %w", t.path, col, err)
+	}
+	return i, nil
+}
+
+func (t *flatTable) getFlag(rec []string, col string) int {
+	switch strings.ToLower(t.get(rec, col)) {
+	case "1", "t", "true", "y", "yes":
+		return 1
+	}
+	return 0
+}
+
+func (t *flatTable) getTime(rec []string, col string) (time.Time, error) {
+	v := t.get(rec, col)
+	if len(v) == 0 {
+		return time.Time{}, nil
+	}
+	for _, layout := range flatFileDateLayouts {
+		d, err := time.Parse(layout, v)
+		if err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s: column %s: unknown date format %s", t.path, col, v)
+}
+
+func (t *flatTable) Close() error {
+	return t.file.Close()
+}
+
+// openDump opens a dump file, decompressing it when its name ends in .gz
+func openDump(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &gzipFile{Reader: gz, file: f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Reader.Close()
+	if e := g.file.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// fileRows merge joins the xrefs file with the structures file, both sorted by UCI
+type fileRows struct {
+	ctx          context.Context
+	query        RowQuery
+	logger       *zap.SugaredLogger
+	sources      map[int]Row
+	structures   *flatTable
+	xrefs        *flatTable
+	structure    []string
+	structureUCI int
+	structureEOF bool
+	lastUCI      int
+	// unknownSources xrefs skipped as their source isn't in the sources file
+	unknownSources int
+	row            Row
+	err            error
+}
+
+func (r *fileRows) Next() bool {
+	for {
+		if err := r.ctx.Err(); err != nil {
+			r.err = err
+			return false
+		}
+
+		rec, err := r.xrefs.read()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			r.err = err
+			return false
+		}
+
+		uci, err := r.xrefs.getInt(rec, "uci")
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if uci < r.lastUCI {
+			r.err = fmt.Errorf("%s: not sorted by UCI, found %d after %d", r.xrefs.path, uci, r.lastUCI)
+			return false
+		}
+		r.lastUCI = uci
+
+		if uci < r.query.Start {
+			continue
+		}
+		if r.query.Finish > 0 && uci >= r.query.Finish {
+			return false
+		}
+
+		found, err := r.seekStructure(uci)
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if !found {
+			continue
+		}
+
+		srcID, err := r.xrefs.getInt(rec, "src_id")
+		if err != nil {
+			r.err = err
+			return false
+		}
+		src, ok := r.sources[srcID]
+		if !ok {
+			r.unknownSources++
+			r.logger.Debugw("Xref of an unknown source skipped", "uci", uci, "src_id", srcID)
+			continue
+		}
+
+		r.row = src
+		r.row.UCI = uci
+		r.row.StandardInchi = r.structures.get(r.structure, "standardinchi")
+		r.row.StandardInchiKey = r.structures.get(r.structure, "standardinchikey")
+		r.row.Smiles = r.structures.get(r.structure, "parent_smiles")
+		if len(r.row.Smiles) == 0 {
+			r.row.Smiles = r.structures.get(r.structure, "smiles")
+		}
+		r.row.SrcCompoundID = r.xrefs.get(rec, "src_compound_id")
+		r.row.AuxSrc = r.xrefs.get(rec, "aux_src")
+		if r.row.Assignment, err = r.xrefs.getInt(rec, "assignment"); err != nil {
+			r.err = err
+			return false
+		}
+		if r.row.Created, err = r.xrefs.getTime(rec, "created"); err != nil {
+			r.err = err
+			return false
+		}
+		if r.row.LastUpdated, err = r.xrefs.getTime(rec, "lastupdated"); err != nil {
+			r.err = err
+			return false
+		}
+		return true
+	}
+}
+
+// seekStructure advances the structures file up to the given UCI
+func (r *fileRows) seekStructure(uci int) (bool, error) {
+	for !r.structureEOF && r.structureUCI < uci {
+		rec, err := r.structures.read()
+		if err == io.EOF {
+			r.structureEOF = true
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+
+		su, err := r.structures.getInt(rec, "uci")
+		if err != nil {
+			return false, err
+		}
+		if su < r.structureUCI {
+			return false, fmt.Errorf("%s: not sorted by UCI, found %d after %d", r.structures.path, su, r.structureUCI)
+		}
+		r.structure = rec
+		r.structureUCI = su
+	}
+
+	return r.structure != nil && r.structureUCI == uci, nil
+}
+
+func (r *fileRows) Scan(row *Row) error {
+	*row = r.row
+	return nil
+}
+
+func (r *fileRows) Err() error {
+	return r.err
+}
+
+func (r *fileRows) Close() error {
+	if r.unknownSources > 0 {
+		r.logger.Warnf("%d xrefs from UCI %d skipped, their src_id isn't in the sources file", r.unknownSources, r.query.Start)
+	}
+	err := r.structures.Close()
+	if e := r.xrefs.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,232 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func fixture(name string) string {
+	return filepath.Join("testdata", "files", name)
+}
+
+// gzipFixture a gzipped copy of a fixture in dir
+func gzipFixture(t *testing.T, dir, name string) string {
+	b, err := ioutil.ReadFile(fixture(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err = zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name+".gz")
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readRows every row of src in the range of q
+func readRows(src RowSource, q RowQuery) ([]Row, error) {
+	it, err := src.Rows(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var rows []Row
+	for it.Next() {
+		var r Row
+		if err = it.Scan(&r); err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+	return rows, it.Err()
+}
+
+func compoundIDs(rows []Row) string {
+	var ids []string
+	for _, r := range rows {
+		ids = append(ids, r.SrcCompoundID)
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestFileSourceRows(t *testing.T) {
+	dir := t.TempDir()
+	files := FlatFiles{Structures: fixture("structures.txt"), Xrefs: fixture("xrefs.txt"), Sources: fixture("sources.txt")}
+
+	for _, tc := range []struct {
+		name    string
+		files   FlatFiles
+		query   RowQuery
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "header",
+			files: files,
+			want:  "CHEMBL17564 DB15994 CHEMBL1098659 DB09140",
+		},
+		{
+			name:  "range",
+			files: files,
+			query: RowQuery{Start: 2, Finish: 5},
+			want:  "CHEMBL1098659",
+		},
+		{
+			name: "gzip",
+			files: FlatFiles{
+				Structures: gzipFixture(t, dir, "structures.txt"),
+				Xrefs:      gzipFixture(t, dir, "xrefs.txt"),
+				Sources:    gzipFixture(t, dir, "sources.txt"),
+			},
+			want: "CHEMBL17564 DB15994 CHEMBL1098659 DB09140",
+		},
+		{
+			name: "columns and separator",
+			files: FlatFiles{
+				Structures:       fixture("structures_noheader.tsv"),
+				Xrefs:            fixture("xrefs_noheader.tsv"),
+				Sources:          fixture("sources_noheader.tsv"),
+				Separator:        "\t",
+				StructureColumns: []string{"UCI", "StandardInchi", "StandardInchiKey", "Parent_Smiles"},
+				XrefColumns:      []string{"uci", "src_id", "src_compound_id", "assignment"},
+				SourceColumns:    []string{"src_id", "name", "name_long"},
+			},
+			want: "CHEMBL17564 DB12345",
+		},
+		{
+			name:    "unsorted",
+			files:   FlatFiles{Structures: files.Structures, Xrefs: fixture("xrefs_unsorted.txt"), Sources: files.Sources},
+			wantErr: "not sorted by UCI, found 1 after 2",
+		},
+		{
+			name:    "unknown date layout",
+			files:   FlatFiles{Structures: files.Structures, Xrefs: fixture("xrefs_baddate.txt"), Sources: files.Sources},
+			wantErr: "unknown date format May 20th",
+		},
+	} {
+		fs, err := NewFileSource(tc.files, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		rows, err := readRows(fs, tc.query)
+		if len(tc.wantErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: got error %v, want %s", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := compoundIDs(rows); got != tc.want {
+			t.Errorf("%s: got compound IDs %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFileSourceJoin(t *testing.T) {
+	fs, err := NewFileSource(FlatFiles{
+		Structures: fixture("structures_noheader.tsv"),
+		Xrefs:      fixture("xrefs_noheader.tsv"),
+		Sources:    fixture("sources_noheader.tsv"),
+		Separator:  "\t",
+
+		StructureColumns: []string{"uci", "standardinchi", "standardinchikey", "smiles"},
+		XrefColumns:      []string{"uci", "src_id", "src_compound_id", "assignment"},
+		SourceColumns:    []string{"src_id", "name", "name_long"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readRows(fs, RowQuery{Start: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Row{
+		UCI:              2,
+		StandardInchi:    "InChI=1S/H2O/h1H2",
+		StandardInchiKey: "XLYOFNOQVPJJNP-UHFFFAOYSA-N",
+		Smiles:           "O",
+		SrcCompoundID:    "DB12345",
+		Assignment:       1,
+		SrcID:            2,
+		SrcNameLong:      "DrugBank",
+		SrcShortName:     "drugbank",
+	}
+	if len(rows) != 1 || rows[0] != want {
+		t.Errorf("got rows %+v, want %+v", rows, want)
+	}
+}
+
+func TestFileSourceDateLayouts(t *testing.T) {
+	fs, err := NewFileSource(FlatFiles{Structures: fixture("structures.txt"), Xrefs: fixture("xrefs.txt"), Sources: fixture("sources.txt")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readRows(fs, RowQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2019, 5, 20, 0, 0, 0, 0, time.UTC)
+	morning := day.Add(8 * time.Hour)
+	for i, want := range []struct {
+		created, lastUpdated time.Time
+	}{
+		{day, time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{day, time.Time{}},
+		{morning, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{morning, time.Time{}},
+	} {
+		if !rows[i].Created.Equal(want.created) || !rows[i].LastUpdated.Equal(want.lastUpdated) {
+			t.Errorf("%s: got created %v and last updated %v, want %v and %v",
+				rows[i].SrcCompoundID, rows[i].Created, rows[i].LastUpdated, want.created, want.lastUpdated)
+		}
+	}
+}
+
+func TestFileSourceReportsUnknownSources(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	fs, err := NewFileSource(FlatFiles{Structures: fixture("structures.txt"), Xrefs: fixture("xrefs.txt"), Sources: fixture("sources.txt")}, zap.New(core).Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readRows(fs, RowQuery{Start: 3, Finish: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// UCI 3 only has an xref of source 99, UCI 4 no structure
+	if got := compoundIDs(rows); got != "DB09140" {
+		t.Errorf("got compound IDs %s, want DB09140", got)
+	}
+	if w := logs.All(); len(w) != 1 || !strings.Contains(w[0].Message, "1 xrefs from UCI 3 skipped") {
+		t.Errorf("got warnings %v, want one about the xref of source 99", w)
+	}
+}
+
+func TestFileSourceMissingFile(t *testing.T) {
+	_, err := NewFileSource(FlatFiles{Structures: fixture("missing.txt"), Xrefs: fixture("xrefs.txt"), Sources: fixture("sources.txt")}, nil)
+	if !os.IsNotExist(err) {
+		t.Errorf("got error %v, want the missing structures file", err)
+	}
+}
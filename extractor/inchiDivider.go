@@ -210,7 +210,6 @@ func (ind *InchiDivider) splitLayer(layer string, reg *regexp.Regexp, separator
 			a, err := strconv.Atoi(nmol)
 			if err != nil {
 				m := fmt.Sprintf("Split InChI error in ")
-				fmt.Println(m)
 				log.Error(m)
 				return nil, err
 			}
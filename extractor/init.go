@@ -5,10 +5,13 @@ import (
 	"database/sql"
 	"fmt"
 	"go.uber.org/zap"
+	"io"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -17,67 +20,175 @@ type extractionResponse struct {
 	isSuccess bool
 }
 
-//Init sets up extractors and loaders
-func Init(l *zap.SugaredLogger, conf *Configuration, isUpdate bool) {
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
+//Init sets up extractors and loaders. ErrInterrupted is returned when a SIGINT or
+//SIGTERM stops the run
+func Init(l *zap.SugaredLogger, conf *Configuration, isUpdate bool) error {
+	ctx, cancel := SignalContext(context.Background(), l)
 	defer cancel()
-	waitForSignal(ctx, l)
 
+	var err error
 	if isUpdate {
-		updateFromLastUCI(ctx, l, conf)
-		updateRemovedSources(ctx, l, conf)
+		err = Update(ctx, l, conf)
 	} else {
-		startExtraction(ctx, l, conf)
+		err = Extract(ctx, l, conf, false)
 	}
-	err := LoadSources(ctx, l, conf)
 	if err != nil {
-		m := fmt.Sprint("Error loading sources", err)
+		return err
+	}
+
+	if !conf.UsesDatabase() || conf.SinkName() != "elasticsearch" {
+		m := fmt.Sprintf("%s source and %s sink, skipping sources load and DB count validation", conf.DBDriver(), conf.SinkName())
 		fmt.Println(m)
-		l.Fatal(m)
+		l.Warn(m)
+		return nil
+	}
+	err = LoadSources(ctx, l, conf)
+	if err != nil {
+		m := fmt.Sprint("Error loading sources ", err)
+		fmt.Println(m)
+		l.Error(m)
+		return err
+	}
+	if conf.BlueGreen.Enabled && !isUpdate {
+		// Validated before moving the alias
+		return nil
+	}
+	_, err = ValidateLoad(ctx, l, conf)
+	return err
+}
+
+//Extract every configured UCI range into the sink, keeping the progress of each
+//partition in the checkpoint file. With resume only the partitions left
+//unfinished by the previous run are extracted, from their last confirmed UCI
+func Extract(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, resume bool) error {
+	partitions, err := planPartitions(conf)
+	if err != nil {
+		m := fmt.Sprint("Invalid query ranges ", err)
+		fmt.Println(m)
+		l.Error(m)
+		return tagError(ErrConfig, err)
+	}
+
+	cp, err := OpenCheckpointStore(conf.CheckpointPath(), planID(conf, partitions), partitions, resume)
+	if err != nil {
+		m := fmt.Sprint("Error opening checkpoint ", err)
+		fmt.Println(m)
+		l.Error(m)
+		return tagError(ErrConfig, err)
+	}
+	l.Infof("Checkpoint kept on %s", conf.CheckpointPath())
+
+	target := conf
+	var bg *blueGreenRun
+	if conf.BlueGreen.Enabled {
+		bg, err = newBlueGreenRun(ctx, l, conf, cp)
+		if err != nil {
+			m := fmt.Sprint("Error setting up the versioned index ", err)
+			fmt.Println(m)
+			l.Error(m)
+			return err
+		}
+		target = bg.target
+	}
+	err = refuseMappingDrift(ctx, l, target)
+	if err != nil {
+		return err
+	}
+
+	exErr := tunedExtraction(ctx, l, target, cp)
+
+	err = cp.Save()
+	checkpointError(l, os.Stdout, err)
+	if ctx.Err() != nil {
+		m := fmt.Sprintf("Extraction interrupted, resume it with --resume. Checkpoint: %s", conf.CheckpointPath())
+		fmt.Println(m)
+		l.Warn(m)
+		return ErrInterrupted
+	}
+	if exErr != nil || bg == nil {
+		return exErr
+	}
+	return bg.promote(ctx)
+}
+
+//Update extracts the UCIs added after the last one indexed and, for databases,
+//the compounds whose sources were removed lately
+func Update(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) error {
+	if conf.SinkName() != "elasticsearch" {
+		m := fmt.Sprintf("Update mode reads the last UCI from the index, it can't be used with the %s sink", conf.SinkName())
+		fmt.Println(m)
+		l.Error(m)
+		return fmt.Errorf("%w: %s", ErrConfig, m)
+	}
+	err := refuseMappingDrift(ctx, l, conf)
+	if err != nil {
+		return err
+	}
+	err = updateFromLastUCI(ctx, l, conf)
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	if err != nil {
+		return err
+	}
+	if conf.UsesDatabase() {
+		err = updateRemovedSources(ctx, l, conf)
+	}
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return err
+}
+
+//ValidateLoad compares the UCI count of the database against the index one,
+//an error is returned when either count can't be fetched
+func ValidateLoad(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) (bool, error) {
+	match, err := validateLoad(ctx, l, conf)
+	if err != nil {
+		return false, err
 	}
-	match := validateLoad(ctx, l, conf)
 	m := fmt.Sprint("Db count and index count match: ", match)
 	fmt.Println(m)
+	l.Info(m)
+	return match, nil
 }
 
-func validateLoad(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) bool {
+func validateLoad(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) (bool, error) {
 
-	db, err := sql.Open("godror", conf.OracleConn)
+	d, err := getDialect(conf.DBDriver())
 	if err != nil {
-		m := fmt.Sprint("Go oracle open ERROR ", err)
+		l.Error(err)
+		return false, tagError(ErrConfig, err)
+	}
+
+	db, err := sql.Open(conf.DBDriver(), conf.DBConn())
+	if err != nil {
+		m := fmt.Sprint("Database open ERROR ", err)
 		fmt.Println(m)
-		l.Panic(m)
-		panic(err)
+		l.Error(m)
+		return false, tagError(ErrSourceUnavailable, err)
 	}
 	defer func(db *sql.DB) {
 		err := db.Close()
 		if err != nil {
-			m := fmt.Sprint("Go oracle Closing DB ", err)
+			m := fmt.Sprint("Database Closing DB ", err)
 			fmt.Println(m)
 			l.Error(m)
 		}
 	}(db)
 
-	var query = `SELECT count(distinct(ucpa.UCI))
-				FROM
-				UC_XREF xref,
-				UC_SOURCE so,
-				UC_STRUCTURE ucpa
-				WHERE xref.UCI = ucpa.UCI
-				AND xref.src_id = so.src_id
-				ORDER BY ucpa.UCI`
+	query := d.countQuery
 
 	l.Debug(query)
-	m := "Counting UCIs in OraDB..."
+	m := "Counting UCIs in DB..."
 	fmt.Println(m)
 	l.Info(m)
 	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		m := fmt.Sprint("Error running query ", err)
 		fmt.Println(m)
-		l.Panic(m)
-		panic(err)
+		l.Error(m)
+		return false, tagError(ErrSourceUnavailable, err)
 	}
 	defer rows.Close()
 
@@ -90,20 +201,24 @@ func validateLoad(ctx context.Context, l *zap.SugaredLogger, conf *Configuration
 		if err != nil {
 			m := fmt.Sprint("Error scanning ", err)
 			fmt.Println(m)
-			l.Panic(m)
-			panic(err)
+			l.Error(m)
+			return false, tagError(ErrSourceUnavailable, err)
 		}
 	}
-	m = fmt.Sprintf("Query to OraDB successful: %d", dbCount)
+	if err := rows.Err(); err != nil {
+		return false, tagError(ErrSourceUnavailable, err)
+	}
+	m = fmt.Sprintf("Query to DB successful: %d", dbCount)
 	fmt.Println(m)
 	l.Info(m)
 	em, err := getElasticManager(ctx, l, conf)
 	if err != nil {
 		m := fmt.Sprint("Error creating elastic manager ", err)
 		fmt.Println(m)
-		l.Panic(m)
-		panic(err)
+		l.Error(m)
+		return false, err
 	}
+	defer em.Close()
 
 	m = "Counting UCIs in ES..."
 	fmt.Println(m)
@@ -112,20 +227,20 @@ func validateLoad(ctx context.Context, l *zap.SugaredLogger, conf *Configuration
 	if err != nil {
 		m := fmt.Sprint("Error getting the total count ", err)
 		fmt.Println(m)
-		l.Panic(m)
-		panic(err)
+		l.Error(m)
+		return false, err
 	}
 	m = fmt.Sprintf("UCI total numbers - Database: %d Index: %d", dbCount, countResult)
 	fmt.Println(m)
 
 	if dbCount == int(countResult) {
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func updateFromLastUCI(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) {
+func updateFromLastUCI(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) error {
 	conf.MaxConcurrent = 2
 	var queryRange = 10000000
 	m := "STARTING UPDATING PROCESS"
@@ -135,22 +250,24 @@ func updateFromLastUCI(ctx context.Context, l *zap.SugaredLogger, conf *Configur
 	if err != nil {
 		m := fmt.Sprint("Error creating elastic manager ", err)
 		fmt.Println(m)
-		l.Panic(m)
-		panic(err)
+		l.Error(m)
+		return err
 	}
 
 	lastUCI, err := em.getLastIndexedUCI()
+	em.Close()
 	if err != nil {
-		l.Panic(err)
+		l.Error(err)
+		return err
 	}
-	em.Close()
 
 	conf.QueryMax.Start = lastUCI - 10
 	conf.QueryMax.Finish = lastUCI + queryRange
-	startExtraction(ctx, l, conf)
+	conf.QueryRanges = nil
+	return startExtraction(ctx, l, conf, nil)
 }
 
-func updateRemovedSources(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) {
+func updateRemovedSources(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) error {
 	conf.MaxConcurrent = 1
 	m := "Updating Removed Sources"
 	fmt.Println(m)
@@ -159,57 +276,34 @@ func updateRemovedSources(ctx context.Context, l *zap.SugaredLogger, conf *Confi
 	if err != nil {
 		m := fmt.Sprint("Error creating elastic manager ", err)
 		fmt.Println(m)
-		l.Panic(m)
-		panic(err)
+		l.Error(m)
+		return err
 	}
 
 	lastUpdatedDate, err := em.getLastUpdated()
+	em.Close()
 	if err != nil {
 		m := fmt.Sprint("Error getting last updated ", err)
 		fmt.Println(m)
-		l.Panic(m)
+		l.Error(m)
+		return err
+	}
+
+	d, err := getDialect(conf.DBDriver())
+	if err != nil {
+		l.Error(err)
+		return tagError(ErrConfig, err)
 	}
-	em.Close()
 
-	var queryTemplate = `
-SELECT ucpa.UCI,
-       ucpa.STANDARDINCHI,
-       ucpa.STANDARDINCHIKEY,
-       ucpa.PARENT_SMILES,
-       xref.SRC_COMPOUND_ID,
-       xref.ASSIGNMENT,
-       xref.CREATED,
-       xref.LASTUPDATED,
-       so.src_id,
-       so.NAME_LONG,
-       so.NAME_LABEL,
-       so.DESCRIPTION,
-       so.BASE_ID_URL,
-       so.NAME,
-       so.BASE_ID_URL_AVAILABLE,
-       so.AUX_FOR_URL,
-       so.PRIVATE
-FROM UC_XREF xref,
-     UC_SOURCE so,
-     UC_STRUCTURE ucpa
-WHERE xref.UCI in (
-    SELECT UCI
-    FROM UC_XREF
-    WHERE LASTUPDATED IS NOT NULL
-      AND LASTUPDATED >= %s
-)
-  AND xref.UCI = ucpa.UCI
-  AND xref.src_id = so.src_id
-ORDER BY ucpa.UCI`
 	sd := lastUpdatedDate.AddDate(0, 0, -15)
-	fd := fmt.Sprintf(`TO_DATE('%s', 'YYYYMMDD')`, sd.Format("20060102"))
-	query := fmt.Sprintf(queryTemplate, fd)
+	fd := d.dateLiteral(sd)
+	query := fmt.Sprintf(d.removedSourcesQuery, fd)
 	l.Debug(query)
 
-	extractOne(ctx, l, conf, query)
+	return extractOne(ctx, l, conf, query)
 }
 
-func extractOne(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, query string) {
+func extractOne(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, query string) error {
 	var extractors []*Extractor
 
 	l.Info("Starting One extractor")
@@ -220,20 +314,40 @@ func extractOne(ctx context.Context, l *zap.SugaredLogger, conf *Configuration,
 
 	l.Infof("MaxConcurrent set: %d", conf.MaxConcurrent)
 	lock := make(chan int, conf.MaxConcurrent)
-	monitorExtraction(ctx, l, conf, lock, &extractorwg, exResponse, &extractorsAttempts, &extractors)
+	monitorCtx, stopMonitor := context.WithCancel(ctx)
+	var mu sync.Mutex
+	monitorDone := monitorExtraction(monitorCtx, l, os.Stdout, conf, lock, &extractorwg, exResponse, &mu, &extractorsAttempts, &extractors)
+	defer func() {
+		stopMonitor()
+		<-monitorDone
+	}()
 
 	if conf.MaxAttempts <= 0 {
-		l.Panic("Maximum number of extractor attempts must be defined and greater than zero")
-		return
+		m := "Maximum number of extractor attempts must be defined and greater than zero"
+		l.Error(m)
+		return fmt.Errorf("%w: %s", ErrConfig, m)
 	}
 	l.Info("MaxAttempts: ", conf.MaxAttempts)
 
+	src, err := newRowSource(conf, l)
+	if err != nil {
+		m := fmt.Sprint("Error opening row source ", err)
+		fmt.Println(m)
+		l.Error(m)
+		return tagError(ErrSourceUnavailable, err)
+	}
+	defer closeRowSource(l, src)
+
+	tracker := newRunTracker()
 	ex := Extractor{
 		id:          1,
-		Oraconn:     conf.OracleConn,
+		Source:      src,
 		Query:       query,
 		Logger:      l,
 		LastIDAdded: 0,
+		sinks:       ConfiguredSink(conf),
+		tracker:     tracker,
+		console:     os.Stdout,
 	}
 
 	extractorsAttempts[1] = 1
@@ -243,127 +357,221 @@ func extractOne(ctx context.Context, l *zap.SugaredLogger, conf *Configuration,
 
 	extractorwg.Wait()
 	l.Info("Wrapping it up")
-	elapsedTime(l, ti)
+	elapsedTime(l, os.Stdout, ti)
+	return tracker.err()
 }
 
-func monitorExtraction(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, lock chan int, extractorwg *sync.WaitGroup, exResponse chan extractionResponse, exAt *map[int]int, extractors *[]*Extractor) {
-	ctx, cancel := context.WithCancel(ctx)
+// monitorExtraction retries the failed extractors until ctx is done, callers
+// cancel it once every extractor has returned and wait for the channel returned
+// to be closed. A failed extractor is already counted on extractorwg for its
+// retry, which is done here when there's none
+func monitorExtraction(ctx context.Context, l *zap.SugaredLogger, w io.Writer, conf *Configuration, lock chan int, extractorwg *sync.WaitGroup, exResponse chan extractionResponse, mu *sync.Mutex, exAt *map[int]int, extractors *[]*Extractor) <-chan struct{} {
 	extractorsAttempts := *exAt
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for {
 			select {
 			case res := <-exResponse:
 				if !res.isSuccess {
+					mu.Lock()
 					m := fmt.Sprintf("FAILED extractor ID: %d - %d to %d ", res.extractor.id, res.extractor.QueryStart, res.extractor.QueryLimit)
-					fmt.Println(m)
+					printConsole(w, m)
 					l.Warnf(m)
 
 					if extractorsAttempts[res.extractor.id] >= conf.MaxAttempts {
+						// No retry, the other extractors carry on and keep reporting
 						m := fmt.Sprintf("CRITICAL Extractor ID: %d Maximum amount of attemps %d reached extractor", res.extractor.id, extractorsAttempts[res.extractor.id])
-						fmt.Println(m)
+						printConsole(w, m)
 						l.Error(m)
-						cancel()
+						mu.Unlock()
+						extractorwg.Done()
 						break
 					}
 
-					query := fmt.Sprintf(conf.Query, res.extractor.QueryStart, res.extractor.QueryLimit)
+					// Retrying from the last UCI confirmed when there's a checkpoint
+					start := res.extractor.QueryStart
+					if cp := res.extractor.checkpoint; cp != nil && cp.Get(res.extractor.id).LastUCI >= start {
+						start = cp.Get(res.extractor.id).LastUCI + 1
+					}
+					query, _ := conf.renderQuery(start, res.extractor.QueryLimit)
 					ex := Extractor{
 						id:          res.extractor.id,
-						Oraconn:     conf.OracleConn,
+						Source:      res.extractor.Source,
 						Query:       query,
-						QueryStart:  res.extractor.QueryStart,
+						QueryStart:  start,
 						QueryLimit:  res.extractor.QueryLimit,
 						Logger:      l,
 						LastIDAdded: 0,
+						checkpoint:  res.extractor.checkpoint,
+						sinks:       res.extractor.sinks,
+						tracker:     res.extractor.tracker,
+						console:     w,
 					}
-					extractorwg.Add(1)
 					go launchExtractor(ctx, l, conf, &ex, exResponse, lock, extractorwg)
 					*extractors = append(*extractors, &ex)
 					extractorsAttempts[res.extractor.id] = extractorsAttempts[res.extractor.id] + 1
 
 					m = fmt.Sprintf("ATTEMPT %d Extractor ID: %d", extractorsAttempts[res.extractor.id], res.extractor.id)
-					println(m)
+					mu.Unlock()
+					printConsole(w, m)
 					l.Warn(m)
 				} else {
 					m := fmt.Sprintf("DONE Extractor ID: %d - %d to %d finished", res.extractor.id, res.extractor.QueryStart, res.extractor.QueryLimit)
 					l.Info(m)
-					fmt.Println(m)
+					printConsole(w, m)
 				}
 			case <-ctx.Done():
 				m := "Canceled extractors response listener because of context done"
 				l.Warn(m)
-				println(m)
+				printConsole(w, m)
 
 				return
 			}
 		}
 	}()
+	return done
 }
 
-func startExtraction(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) {
-	ti := time.Now()
-	var extractors []*Extractor
-
-	interval := conf.Interval
-	start := conf.QueryMax.Start
-	finish := conf.QueryMax.Finish
-	var extractorwg sync.WaitGroup
-	exResponse := make(chan extractionResponse)
-	extractorsAttempts := map[int]int{}
+// tunedExtraction disables refreshes and replicas of the Elasticsearch index
+// while extracting. The original settings, saved on the checkpoint first, are
+// restored however the extraction ends, followed by a force merge and a refresh
+func tunedExtraction(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, cp *CheckpointStore) (err error) {
+	if conf.SinkName() != "elasticsearch" {
+		return startExtraction(ctx, l, conf, cp)
+	}
 
-	l.Infof("MaxConcurrent set: %d", conf.MaxConcurrent)
-	lock := make(chan int, conf.MaxConcurrent)
-	monitorExtraction(ctx, l, conf, lock, &extractorwg, exResponse, &extractorsAttempts, &extractors)
+	em, err := getElasticManager(ctx, l, conf)
+	if err != nil {
+		m := fmt.Sprint("Error creating elastic manager ", err)
+		fmt.Println(m)
+		l.Error(m)
+		return err
+	}
+	defer em.Close()
 
-	if conf.MaxAttempts <= 0 {
-		l.Panic("Maximum number of extractor attempts must be defined and greater than zero")
+	// A resumed load, or the one following a crashed load, restores the settings
+	// saved before the first attempt
+	original := cp.loadSettings(em.IndexName)
+	if original == nil {
+		ls, err := em.getLoadSettings(ctx)
+		if err != nil {
+			return err
+		}
+		original = &ls
+		checkpointError(l, os.Stdout, cp.setLoadSettings(em.IndexName, original))
 	}
-	l.Info("MaxAttempts: ", conf.MaxAttempts)
 
-	iterations := ((finish - start) / interval) + 1
-	l.Info("Iterations: ", iterations)
-
-	for i := 0; i < iterations; i++ {
-
-		init := start + (i * interval)
-		end := init + interval
-		m := fmt.Sprintf("Dispatching Extractor ID: %d from %d to %d ", i, init, end)
-		l.Infof(m)
-		println(m)
-		query := fmt.Sprintf(conf.Query, init, end)
-		ex := Extractor{
-			id:          i,
-			Oraconn:     conf.OracleConn,
-			Query:       query,
-			QueryStart:  init,
-			QueryLimit:  end,
-			Logger:      l,
-			LastIDAdded: 0,
+	defer func() {
+		// The run context may be canceled already, restoring can't be skipped.
+		// An interrupted run only waits the shutdown timeout and doesn't merge
+		rctx, cancel := context.Background(), func() {}
+		if ctx.Err() != nil {
+			rctx, cancel = context.WithTimeout(rctx, conf.ShutdownTimeoutDuration())
+		}
+		defer cancel()
+		rerr := em.endLoad(rctx, *original, ctx.Err() == nil)
+		if rerr != nil {
+			m := fmt.Sprint("Error restoring the index settings ", rerr)
+			fmt.Println(m)
+			l.Error(m)
+			if err == nil {
+				err = rerr
+			}
+			return
 		}
+		checkpointError(l, os.Stdout, cp.setLoadSettings(em.IndexName, nil))
+	}()
+
+	err = em.beginLoad(ctx, *original)
+	if err != nil {
+		return err
+	}
+	return startExtraction(ctx, l, conf, cp)
+}
 
-		extractorsAttempts[i] = 1
+// startExtraction runs the Pipeline of the configured source and sink, cp is nil
+// when no checkpoint is kept
+func startExtraction(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, cp *CheckpointStore) error {
+	src, err := newRowSource(conf, l)
+	if err != nil {
+		m := fmt.Sprint("Error opening row source ", err)
+		fmt.Println(m)
+		l.Error(m)
+		return tagError(ErrSourceUnavailable, err)
+	}
+	defer closeRowSource(l, src)
+
+	_, err = NewPipeline(src, ConfiguredSink(conf), WithConfiguration(conf), WithLogger(l), WithConsole(os.Stdout), WithCheckpoint(cp)).Run(ctx)
+	return err
+}
 
-		extractorwg.Add(1)
-		go launchExtractor(ctx, l, conf, &ex, exResponse, lock, &extractorwg)
-		extractors = append(extractors, &ex)
+// Partition UCI range, finish excluded, queried by one extractor
+type Partition struct {
+	ID, Start, Finish int
+	// Query rendered for database sources, empty otherwise
+	Query string
+}
+
+// planPartitions splits every configured range by Interval. Partition IDs keep
+// counting across ranges, they key the retry attempts
+func planPartitions(conf *Configuration) ([]Partition, error) {
+	ranges := conf.Ranges()
+	err := checkRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Interval <= 0 {
+		return nil, fmt.Errorf("interval must be greater than 0")
+	}
 
-		// Giving the first extractor a head start
-		if i == 0 {
-			time.Sleep(300 * time.Millisecond)
+	var partitions []Partition
+	for _, r := range ranges {
+		for init := r.Start; init < r.Finish; init += conf.Interval {
+			end := init + conf.Interval
+			// Don't let the last extractor of a range run into the next one
+			if end > r.Finish {
+				end = r.Finish
+			}
+			query, err := conf.renderQuery(init, end)
+			if err != nil {
+				return nil, err
+			}
+			partitions = append(partitions, Partition{ID: len(partitions), Start: init, Finish: end, Query: query})
 		}
 	}
+	return partitions, nil
+}
 
-	extractorwg.Wait()
-	l.Info("Wrapping it up")
-	printStatus(l, extractors)
-	elapsedTime(l, ti)
+// checkRanges every range must be non empty and not overlap the others
+func checkRanges(ranges []Range) error {
+	sorted := make([]Range, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	for i, r := range sorted {
+		if r.Finish <= r.Start {
+			return fmt.Errorf("range %d to %d, finish must be greater than start", r.Start, r.Finish)
+		}
+		if i > 0 && r.Start < sorted[i-1].Finish {
+			return fmt.Errorf("range %d to %d overlaps %d to %d", r.Start, r.Finish, sorted[i-1].Start, sorted[i-1].Finish)
+		}
+	}
+	return nil
 }
 
 func launchExtractor(ctx context.Context, l *zap.SugaredLogger, cn *Configuration, ex *Extractor, exResponse chan extractionResponse, lock chan int, wg *sync.WaitGroup) {
-	lock <- 0
+	// No new extractor is started once the run is canceled
+	select {
+	case lock <- 0:
+	case <-ctx.Done():
+		l.Warnf("CANCELED Extractor ID:%d before starting", ex.id)
+		wg.Done()
+		return
+	}
 	m := fmt.Sprintf("STARTED Extractor ID: %d from %d to %d", ex.id, ex.QueryStart, ex.QueryLimit)
 	l.Infof(m)
-	println(m)
+	printConsole(ex.console, m)
 
 	defer deLock(lock, l, ex.QueryStart, ex.id)
 	defer wg.Done()
@@ -374,38 +582,72 @@ func launchExtractor(ctx context.Context, l *zap.SugaredLogger, cn *Configuratio
 	logger := l
 	var err error
 
-	select {
-	case <-ctx.Done():
-		m := fmt.Sprintf("CANCELED Extractor ID:%d", ex.id)
-		logger.Warn(m)
-		cancel()
-		return
-	default:
-	}
+	// The sink outlives the run context, batches already sent are drained on
+	// cancellation and only aborted after the shutdown timeout
+	sinkCtx, sinkCancel := context.WithCancel(context.Background())
+	defer sinkCancel()
 
-	em, err := getElasticManager(ctx, l, cn)
+	ex.tracker.attempt(ex)
+	sink, err := ex.sinks(sinkCtx, l, fmt.Sprintf("%d-%d", ex.QueryStart, ex.QueryLimit))
 	if err != nil {
-		logger.Panic("Error creating elastic manager ", err)
-		panic(err)
+		m := fmt.Sprint("Error creating sink ", err)
+		printConsole(ex.console, m)
+		logger.Error(m)
+		ex.tracker.fail(ex, err)
+		reportExtraction(ctx, exResponse, *ex, false, wg)
+		return
 	}
-	defer em.Close()
 
-	ex.ElasticManager = em
+	// Start sends either on exError or on inFinish and never blocks on them,
+	// exDone is closed once it returns
+	exError := make(chan error, 1)
+	inFinish := make(chan int, 1)
+	exDone := make(chan struct{})
+	timedOut := false
+	defer func() {
+		cancel()
+		if timedOut {
+			// The batches still in flight are aborted, the extractor and the
+			// sink are released in the background
+			sinkCancel()
+			go releaseSink(l, ex.console, sink, exDone)
+			return
+		}
+		releaseSink(l, ex.console, sink, exDone)
+	}()
 
-	exError := make(chan error)
-	inFinish := make(chan int)
+	ex.Sink = sink
 	ex.inFinish = inFinish
 	ex.exerror = exError
 	isExtractorDone := false
+	doneJobs := 0
+	watermark := newBatchWatermark()
 	go func() {
+		defer close(exDone)
 		err := ex.Start(ctx)
 		if err != nil {
 			m := fmt.Sprint("Error starting extractor ", err)
-			fmt.Println(m)
+			printConsole(ex.console, m)
 			logger.Error(m)
 		}
 	}()
 
+	// done is disabled and drainTimeout armed once the context is canceled
+	done := ctx.Done()
+	var drainTimeout <-chan time.Time
+	draining := false
+	drain := func() {
+		if draining {
+			return
+		}
+		m := fmt.Sprintf("Context canceled Extractor ID:%d, draining %d batches", ex.id, sink.Sent()-doneJobs)
+		logger.Warn(m)
+		printConsole(ex.console, m)
+		draining = true
+		done = nil
+		drainTimeout = time.After(cn.ShutdownTimeoutDuration())
+	}
+
 d:
 	for {
 		select {
@@ -416,32 +658,41 @@ d:
 			if ex.PreviousCompound.UCI == 0 {
 				break d
 			}
-			if isExtractorDone && em.totalDoneJobs >= em.totalSentJobs {
+			if isExtractorDone && doneJobs >= sink.Sent() {
 				break d
 			}
 		case err := <-exError:
+			if draining || ctx.Err() != nil {
+				// Interrupted by the cancellation, only the batches sent are waited for
+				drain()
+				isExtractorDone = true
+				if doneJobs >= sink.Sent() {
+					break d
+				}
+				continue
+			}
 			m := fmt.Sprintf("Extractor ID: %d error", ex.id)
 			logger.Error(m)
-			fmt.Println(err.Error())
-			exResponse <- extractionResponse{
-				extractor: *ex,
-				isSuccess: false,
-			}
+			printConsole(ex.console, err.Error())
+			ex.tracker.fail(ex, err)
+			reportExtraction(ctx, exResponse, *ex, false, wg)
 			return
-		case <-ctx.Done():
-			m := fmt.Sprintf("Context canceled Extractor ID:%d", ex.id)
-			logger.Warn(m)
-			cancel()
+		case <-done:
+			drain()
+		case <-drainTimeout:
+			m := fmt.Sprintf("Extractor ID:%d shutdown timeout, %d batches not confirmed", ex.id, sink.Sent()-doneJobs)
+			logger.Error(m)
+			printConsole(ex.console, m)
+			timedOut = true
 			return
-		case esResponse := <-em.Respchan:
-			l.Debugf("Got response, Extractor status: %t TOTAL DONE JOBS: %d TOTAL SENT JOBS: %d", isExtractorDone, em.totalDoneJobs, em.totalSentJobs)
+		case wr := <-sink.Responses():
+			doneJobs++
+			ex.tracker.response(ex, wr)
+			l.Debugf("Got response, Extractor status: %t TOTAL DONE JOBS: %d TOTAL SENT JOBS: %d", isExtractorDone, doneJobs, sink.Sent())
 
-			if esResponse.BulkResponse.Errors {
+			if wr.Errors {
 				logger.Error("Bulk response reported errors")
-			} else {
-				succeeded := esResponse.BulkResponse.Succeeded()
-
-				lastSucceded := succeeded[len(succeeded)-1]
+			} else if len(wr.LastSucceededID) > 0 {
 				logger.Infow(
 					"WORKER_RESPONSE",
 					"extractorID",
@@ -449,31 +700,33 @@ d:
 					"extractorStarted",
 					ex.QueryStart,
 					"lastSucceeded",
-					lastSucceded.Id,
+					wr.LastSucceededID,
 					"Took",
-					esResponse.BulkResponse.Took,
+					wr.Took,
 				)
 
-				li, err := strconv.Atoi(lastSucceded.Id)
+				li, err := strconv.Atoi(wr.LastSucceededID)
 				if err != nil {
-					logger.Panic("Error turning ID into int ", err)
+					m := fmt.Sprint("Error turning ID into int ", err)
+					printConsole(ex.console, m)
+					logger.Error(m)
+					ex.tracker.fail(ex, tagError(ErrSinkRejected, err))
+					reportExtraction(ctx, exResponse, *ex, false, wg)
+					return
 				}
 				if ex.LastIDAdded < li {
 					ex.LastIDAdded = li
 				}
-				em.totalDoneJobs++
 			}
-			if esResponse.Failed > 0 {
+			if wr.Failed > 0 {
 				m := fmt.Sprintf("Failed records on bulk. Extractor ID: %d", ex.id)
 				logger.Error(m)
 
 				ids := ""
 				reasons := ""
 
-				failed := esResponse.BulkResponse.Failed()
-				lastFailed := failed[len(failed)-1]
-				fr := esResponse.BulkResponse.Failed()
-				logger.Error(fr[0].Error.Reason)
+				failed := wr.FailedItems
+				logger.Error(failed[0].Reason)
 				logger.Errorw(
 					"WORKER_ERROR",
 					"extractorID",
@@ -481,55 +734,129 @@ d:
 					"extractorStarted",
 					ex.QueryStart,
 					"Took",
-					esResponse.BulkResponse.Took,
+					wr.Took,
 					"succeeded",
-					esResponse.Succeeded,
+					wr.Succeeded,
 					"indexed",
-					esResponse.Indexed,
+					wr.Indexed,
 					"failed",
-					esResponse.Failed,
+					wr.Failed,
 					"startedOn",
-					failed[0].Id,
+					failed[0].ID,
 					"lastFailed",
-					lastFailed.Id,
+					failed[len(failed)-1].ID,
 				)
-				for _, it := range esResponse.BulkResponse.Failed() {
-					ids = ids + "," + it.Id
-					reasons = reasons + " " + it.Error.Reason
+				for _, it := range failed {
+					ids = ids + "," + it.ID
+					reasons = reasons + " " + it.Reason
 				}
 				logger.Debug("IDs with error ", ids)
 				logger.Debug("Reasons: ", reasons)
 
-				exResponse <- extractionResponse{
-					extractor: *ex,
-					isSuccess: false,
-				}
+				ex.tracker.fail(ex, &RejectedError{Items: failed})
+				reportExtraction(ctx, exResponse, *ex, false, wg)
 				cancel()
 				return
 			}
-			if isExtractorDone && em.totalDoneJobs >= em.totalSentJobs {
+			if ex.checkpoint != nil {
+				li, _ := strconv.Atoi(wr.LastSucceededID)
+				if watermark.confirm(wr.Batch, li) {
+					checkpointError(l, ex.console, ex.checkpoint.Confirm(ex.id, watermark.uci))
+				}
+			}
+			if isExtractorDone && doneJobs >= sink.Sent() {
 				break d
 			}
-		case err = <-em.Errchan:
+		case err = <-sink.Errors():
 			m := fmt.Sprintf("For worker started on %d Got error from bulk", ex.QueryStart)
-			println(m)
+			printConsole(ex.console, m)
 			logger.Error(m)
-			println(err.Error())
+			printConsole(ex.console, err.Error())
 
-			exResponse <- extractionResponse{
-				extractor: *ex,
-				isSuccess: false,
-			}
+			ex.tracker.fail(ex, tagError(ErrSinkUnavailable, err))
+			reportExtraction(ctx, exResponse, *ex, false, wg)
+
+			return
+		}
+	}
+	logger.Infof("Waiting for sink to finish. Extractor ID: %d", ex.id)
+	sink.Wait()
+	// A partition is only done when read to its end without being canceled
+	if draining || ctx.Err() != nil {
+		m := fmt.Sprintf("DRAINED Extractor ID: %d last confirmed UCI: %d", ex.id, watermark.uci)
+		logger.Warn(m)
+		printConsole(ex.console, m)
+		return
+	}
+	if ex.checkpoint != nil {
+		checkpointError(l, ex.console, ex.checkpoint.Done(ex.id))
+	}
+
+	ex.tracker.done(ex)
+	reportExtraction(ctx, exResponse, *ex, true, wg)
+}
+
+// reportExtraction sends the outcome to monitorExtraction, which stops
+// listening once the run is canceled. A failure is counted on wg for its retry
+// before the attempt itself is done, so waiting on wg covers the retries
+func reportExtraction(ctx context.Context, exResponse chan extractionResponse, ex Extractor, success bool, wg *sync.WaitGroup) {
+	if !success {
+		wg.Add(1)
+	}
+	select {
+	case exResponse <- extractionResponse{extractor: ex, isSuccess: success}:
+	case <-ctx.Done():
+		if !success {
+			wg.Done()
+		}
+	}
+}
+
+// checkpointError a checkpoint that can't be written doesn't stop the extraction,
+// only resuming is affected
+func checkpointError(l *zap.SugaredLogger, w io.Writer, err error) {
+	if err != nil {
+		m := fmt.Sprint("Error writing checkpoint ", err)
+		printConsole(w, m)
+		l.Error(m)
+	}
+}
 
+// releaseSink discards the responses of sink until the extractor feeding it,
+// which closes exDone, and its batches are done, then closes it
+func releaseSink(l *zap.SugaredLogger, w io.Writer, sink Sink, exDone <-chan struct{}) {
+	done := make(chan struct{})
+	go func() {
+		<-exDone
+		sink.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-sink.Responses():
+		case <-sink.Errors():
+		case <-done:
+			closeSink(l, w, sink)
 			return
 		}
 	}
-	logger.Infof("Waiting for elastic manager to finish. Extractor ID: %d", ex.id)
-	em.WaitGroup.Wait()
+}
+
+func closeSink(l *zap.SugaredLogger, w io.Writer, sink Sink) {
+	err := sink.Close()
+	if err != nil {
+		m := fmt.Sprint("Error closing sink ", err)
+		printConsole(w, m)
+		l.Error(m)
+	}
+}
 
-	exResponse <- extractionResponse{
-		extractor: *ex,
-		isSuccess: true,
+func closeRowSource(l *zap.SugaredLogger, src RowSource) {
+	err := src.Close()
+	if err != nil {
+		m := fmt.Sprint("Error closing row source ", err)
+		fmt.Println(m)
+		l.Error(m)
 	}
 }
 
@@ -542,17 +869,19 @@ func getElasticManager(ctx context.Context, l *zap.SugaredLogger, cn *Configurat
 	logger := l
 
 	if cn.BulkLimit <= 0 {
-		logger.Panic("BulkLimit must be a number higher than 0")
+		logger.Error("BulkLimit must be a number higher than 0")
+		return nil, fmt.Errorf("%w: bulklimit must be a number higher than 0", ErrConfig)
 	}
 
 	if cn.MaxBulkCalls <= 0 {
-		logger.Panic("MaxBulkCalls must be a number higher than 0")
+		logger.Error("MaxBulkCalls must be a number higher than 0")
+		return nil, fmt.Errorf("%w: maxbulkcalls must be a number higher than 0", ErrConfig)
 	}
 
 	es := ElasticManager{
 		Context:      ctx,
-		IndexName:    "unichem",
-		TypeName:     "compound",
+		IndexName:    cn.IndexName(),
+		TypeName:     cn.TypeName(),
 		Bulklimit:    cn.BulkLimit,
 		MaxBulkCalls: cn.MaxBulkCalls,
 	}
@@ -566,31 +895,38 @@ func getElasticManager(ctx context.Context, l *zap.SugaredLogger, cn *Configurat
 	return &es, nil
 }
 
-func waitForSignal(ctx context.Context, l *zap.SugaredLogger) {
-	c := make(chan os.Signal, 1)
+//SignalContext a context canceled on SIGINT or SIGTERM. Canceling it stops
+//dispatching extractors, the running ones drain the batches already sent
+func SignalContext(ctx context.Context, l *zap.SugaredLogger) (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(ctx)
-	signal.Notify(c, os.Interrupt)
-	signal.Notify(c, os.Kill)
-	go func(cancel context.CancelFunc) {
-		ossig := <-c
-		l.Warnf("Received OS Signal: %+v", ossig)
-		cancel()
-		// os.Exit(1)
-	}(cancel)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(c)
+		select {
+		case ossig := <-c:
+			m := fmt.Sprintf("Received OS Signal: %+v, shutting down", ossig)
+			fmt.Println(m)
+			l.Warn(m)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
-func elapsedTime(l *zap.SugaredLogger, t time.Time) {
+func elapsedTime(l *zap.SugaredLogger, w io.Writer, t time.Time) {
 	logger := l
 	e := time.Since(t)
 	m := fmt.Sprintf("Elapsed %s", e)
-	println(m)
+	printConsole(w, m)
 	logger.Infof(m)
 }
 
-func printStatus(l *zap.SugaredLogger, extractors []*Extractor) {
+func printStatus(l *zap.SugaredLogger, w io.Writer, extractors []*Extractor) {
 	for _, ex := range extractors {
 		m := fmt.Sprintf("For worker started on %d Last compound UCI: %d", ex.QueryStart, ex.LastIDAdded)
-		println(m)
+		printConsole(w, m)
 		l.Warn(m)
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/olivere/elastic/v7"
@@ -16,32 +17,32 @@ import (
 // CompoundSource is the source where the unichem database extracted that
 // compound
 type CompoundSource struct {
-	ID                 int       `json:"id"`
-	Name               string    `json:"name"`
-	LongName           string    `json:"long_name"`
-	CompoundID         string    `json:"compound_id"`
-	Description        string    `json:"description"`
-	BaseURL            string    `json:"base_url"`
-	ShortName          string    `json:"short_name"`
-	BaseIDURLAvailable bool      `json:"base_id_url_available"`
-	AuxSrc             string    `json:"aux_src"`
-	AuxForURL          bool      `json:"aux_for_url"`
-	CreatedAt          time.Time `json:"created_at"`
-	LastUpdate         time.Time `json:"last_updated,omitempty"`
-	IsPrivate          bool      `json:"is_private"`
+	ID                 int       `json:"id" bson:"id"`
+	Name               string    `json:"name" bson:"name"`
+	LongName           string    `json:"long_name" bson:"longName"`
+	CompoundID         string    `json:"compound_id" bson:"compoundID"`
+	Description        string    `json:"description" bson:"description"`
+	BaseURL            string    `json:"base_url" bson:"baseURL"`
+	ShortName          string    `json:"short_name" bson:"shortName"`
+	BaseIDURLAvailable bool      `json:"base_id_url_available" bson:"baseIDURLAvailable"`
+	AuxSrc             string    `json:"aux_src" bson:"auxSrc"`
+	AuxForURL          bool      `json:"aux_for_url" bson:"auxForURL"`
+	CreatedAt          time.Time `json:"created_at" bson:"createdAt"`
+	LastUpdate         time.Time `json:"last_updated,omitempty" bson:"lastUpdated,omitempty"`
+	IsPrivate          bool      `json:"is_private" bson:"isPrivate"`
 }
 
 // Compound is an structure describing the information to be indexed
 // extracted from Unichem database
 type Compound struct {
-	UCI              int              `json:"uci"`
-	Inchi            Inchi            `json:"inchi"`
-	Components       []Inchi          `json:"components,omitempty"`
-	StandardInchiKey string           `json:"standard_inchi_key"`
-	Smiles           string           `json:"smiles"`
-	Sources          []CompoundSource `json:"sources,omitempty"`
-	CreatedAt        time.Time        `json:"created_at"`
-	IsSourceless     bool             `json:"is_sourceless"`
+	UCI              int              `json:"uci" bson:"uci"`
+	Inchi            Inchi            `json:"inchi" bson:"inchi"`
+	Components       []Inchi          `json:"components,omitempty" bson:"components,omitempty"`
+	StandardInchiKey string           `json:"standard_inchi_key" bson:"standardInchiKey"`
+	Smiles           string           `json:"smiles" bson:"smiles"`
+	Sources          []CompoundSource `json:"sources,omitempty" bson:"sources,omitempty"`
+	CreatedAt        time.Time        `json:"created_at" bson:"createdAt"`
+	IsSourceless     bool             `json:"is_sourceless" bson:"isSourceless"`
 }
 
 // UCICount is the amount of UCI by Sources on UniChem
@@ -50,19 +51,8 @@ type UCICount struct {
 	Source   int `json:"source"`
 }
 
-// WorkerResponse contains the result of the BulkRequest to the ElasticSearch index
-type WorkerResponse struct {
-	Succeeded    int
-	Indexed      int
-	Created      int
-	Updated      int
-	Deleted      int
-	Failed       int
-	BulkResponse *elastic.BulkResponse
-}
-
 // ElasticManager used for connection and adding compounds to the
-// elastic server
+// elastic server, it is the Elasticsearch implementation of Sink
 type ElasticManager struct {
 	logger             *zap.SugaredLogger
 	Context            context.Context
@@ -77,8 +67,7 @@ type ElasticManager struct {
 	WaitGroup          sync.WaitGroup
 	currentBulkCalls   int
 	MaxBulkCalls       int
-	totalSentJobs      int
-	totalDoneJobs      int
+	totalSentJobs      int64
 }
 
 // Init function initializes an elastic client and pings it to check the provider server is up
@@ -87,11 +76,7 @@ func (em *ElasticManager) Init(ctx context.Context, conf *Configuration, logger
 	// ctx = context.Background()
 	em.Context = ctx
 
-	if len(conf.ESIndexSettings) <= 0 {
-		logger.Panic("ES Index Setting can't be empty. PLease provide a valid one on the configuration file")
-	}
-
-	mapping := conf.ESIndexSettings
+	mapping := conf.IndexSettings()
 
 	var err error
 	em.Client, err = elastic.NewClient(
@@ -100,34 +85,34 @@ func (em *ElasticManager) Init(ctx context.Context, conf *Configuration, logger
 		elastic.SetBasicAuth(conf.ElasticAuth.Username, conf.ElasticAuth.Password),
 	)
 	if err != nil {
-		em.logger.Panic("Error connecting to ElasticSearch ", err)
-		return err
+		em.logger.Error("Error connecting to ElasticSearch ", err)
+		return tagError(ErrSinkUnavailable, err)
 	}
 
 	inf, code, err := em.Client.Ping(conf.ElasticHost).Do(ctx)
 	if err != nil {
-		em.logger.Panic("Error Pinging elastic client ", err)
-		return err
+		em.logger.Error("Error Pinging elastic client ", err)
+		return tagError(ErrSinkUnavailable, err)
 	}
 	em.logger.Infof("Succesfully pinged ElasticSearch server with code %d and version %s", code, inf.Version.Number)
 
 	ex, err := em.Client.IndexExists(em.IndexName).Do(ctx)
 	if err != nil {
-		em.logger.Panic("Error fetching index existence ", err)
-		return err
+		em.logger.Error("Error fetching index existence ", err)
+		return tagError(ErrSinkUnavailable, err)
 	}
 
 	if !ex {
 		in, err := em.Client.CreateIndex(em.IndexName).BodyString(mapping).Do(ctx)
 		em.logger.Infof("Creating index %s", em.IndexName)
 		if err != nil {
-			em.logger.Panic("Error creating index  ", err)
-			return err
+			em.logger.Error("Error creating index  ", err)
+			return tagError(ErrSinkRejected, err)
 		}
 
 		if !in.Acknowledged {
 			em.logger.Error("Index creation not acknowledged")
-			return err
+			return fmt.Errorf("%w: index %s creation not acknowledged", ErrSinkRejected, em.IndexName)
 		}
 		// Giving ES time to set up the Index
 		time.Sleep(2 * time.Second)
@@ -139,15 +124,14 @@ func (em *ElasticManager) Init(ctx context.Context, conf *Configuration, logger
 	em.currentBulkCalls = 0
 	em.countBulkRequest = 0
 	em.totalSentJobs = 0
-	em.totalDoneJobs = 0
 
 	em.Errchan = make(chan error)
 	em.Respchan = make(chan WorkerResponse)
 	return nil
 }
 
-// AddToBulk fills a BulkRequest up to the limit set up on the em.Bulklimit property
-func (em *ElasticManager) AddToBulk(c Compound) {
+// Add fills a BulkRequest up to the limit set up on the em.Bulklimit property
+func (em *ElasticManager) Add(c Compound) error {
 
 	em.logger.Debugw(
 		"Adding to bulk: ",
@@ -173,49 +157,67 @@ func (em *ElasticManager) AddToBulk(c Compound) {
 			em.currentBulkCalls = 0
 		}
 
-		em.totalSentJobs++
+		batch := int(atomic.AddInt64(&em.totalSentJobs, 1))
 
 		em.WaitGroup.Add(1)
 		em.logger.Debugf("Sending bulk triggered by: %d", c.UCI)
-		go em.sendBulkRequest(em.Context, em.Errchan, em.Respchan, em.currentBulkService, c.UCI)
+		go em.sendBulkRequest(em.Context, em.Errchan, em.Respchan, em.currentBulkService, batch, c.UCI)
 
 		em.countBulkRequest = 1
 		em.currentBulkService = em.Client.Bulk()
 	}
 
 	t := elastic.NewBulkUpdateRequest().Index(em.IndexName).DocAsUpsert(true).Id(strconv.Itoa(c.UCI)).Doc(c)
+	if len(em.TypeName) > 0 {
+		t = t.Type(em.TypeName)
+	}
 	em.currentBulkService = em.currentBulkService.Add(t)
 
+	return nil
 }
 
-//SendCurrentBulk through a worker, useful for cleaning the requests stored on the BulkService
+//Flush sends the current BulkRequest, useful for cleaning the requests stored on the BulkService
 //regardless the BulkLimit has been reached or not
-func (em *ElasticManager) SendCurrentBulk() {
+func (em *ElasticManager) Flush() error {
 	if em.currentBulkService.NumberOfActions() > 0 {
-		em.totalSentJobs++
+		batch := int(atomic.AddInt64(&em.totalSentJobs, 1))
 
 		br, err := em.currentBulkService.Do(em.Context)
 		if err != nil {
-			em.Errchan <- err
-			return
-		}
-		wr := WorkerResponse{
-			Succeeded:    len(br.Succeeded()),
-			Indexed:      len(br.Indexed()),
-			Created:      len(br.Created()),
-			Updated:      len(br.Updated()),
-			Failed:       len(br.Failed()),
-			BulkResponse: br,
+			return err
 		}
 
+		wr := newWorkerResponse(br)
+		wr.Batch = batch
 		em.Respchan <- wr
 		em.logger.Debug("END last bulk sent")
 	} else {
 		em.logger.Warn("No actions on current bulk service, skipping last bulk")
 	}
+	return nil
 }
 
-func (em *ElasticManager) sendBulkRequest(ctx context.Context, ce chan error, cr chan WorkerResponse, b *elastic.BulkService, UCI int) {
+//Responses channel where every bulk response is reported
+func (em *ElasticManager) Responses() <-chan WorkerResponse {
+	return em.Respchan
+}
+
+//Errors channel where failed bulk requests are reported
+func (em *ElasticManager) Errors() <-chan error {
+	return em.Errchan
+}
+
+//Sent number of bulk requests dispatched
+func (em *ElasticManager) Sent() int {
+	return int(atomic.LoadInt64(&em.totalSentJobs))
+}
+
+//Wait blocks until the bulk workers are done
+func (em *ElasticManager) Wait() {
+	em.WaitGroup.Wait()
+}
+
+func (em *ElasticManager) sendBulkRequest(ctx context.Context, ce chan error, cr chan WorkerResponse, b *elastic.BulkService, batch, UCI int) {
 
 	defer em.WaitGroup.Done()
 	em.logger.Debugf("INIT bulk worker %d", UCI)
@@ -224,18 +226,36 @@ func (em *ElasticManager) sendBulkRequest(ctx context.Context, ce chan error, cr
 		ce <- err
 		return
 	}
-	wr := WorkerResponse{
-		Succeeded:    len(br.Succeeded()),
-		Indexed:      len(br.Indexed()),
-		Created:      len(br.Created()),
-		Updated:      len(br.Updated()),
-		Failed:       len(br.Failed()),
-		BulkResponse: br,
-	}
+	wr := newWorkerResponse(br)
+	wr.Batch = batch
 	cr <- wr
 	em.logger.Debugf("END bulk worker %d", UCI)
 }
 
+func newWorkerResponse(br *elastic.BulkResponse) WorkerResponse {
+	wr := WorkerResponse{
+		Succeeded: len(br.Succeeded()),
+		Indexed:   len(br.Indexed()),
+		Created:   len(br.Created()),
+		Updated:   len(br.Updated()),
+		Deleted:   len(br.Deleted()),
+		Failed:    len(br.Failed()),
+		Took:      br.Took,
+		Errors:    br.Errors,
+	}
+	if succeeded := br.Succeeded(); len(succeeded) > 0 {
+		wr.LastSucceededID = succeeded[len(succeeded)-1].Id
+	}
+	for _, it := range br.Failed() {
+		fi := FailedItem{ID: it.Id}
+		if it.Error != nil {
+			fi.Reason = it.Error.Reason
+		}
+		wr.FailedItems = append(wr.FailedItems, fi)
+	}
+	return wr
+}
+
 func (em *ElasticManager) getCount() (int64, error) {
 	ctx := em.Context
 	l := em.logger
@@ -243,10 +263,10 @@ func (em *ElasticManager) getCount() (int64, error) {
 
 	countResult, err := em.Client.Count().Index(em.IndexName).Do(ctx)
 	if err != nil {
-		m := fmt.Sprint("Error getting index total UCI", err)
+		m := fmt.Sprint("Error getting index total UCI ", err)
 		fmt.Println(m)
-		l.Fatal(m)
-		return 0, err
+		l.Error(m)
+		return 0, tagError(ErrSinkUnavailable, err)
 	}
 	l.Info("Elastic count result: ", countResult)
 
@@ -260,20 +280,20 @@ func (em *ElasticManager) getLastIndexedUCI() (int, error) {
 	termQuery := elastic.NewMatchAllQuery()
 	searchResults, err := em.Client.Search().Index(em.IndexName).Query(termQuery).Sort("uci", false).Size(1).Do(ctx)
 	if err != nil {
-		m := fmt.Sprint("Error getting getting last UCI indexed", err)
+		m := fmt.Sprint("Error getting getting last UCI indexed ", err)
 		fmt.Println(m)
-		l.Fatal(m)
+		l.Error(m)
 
-		return 0, err
+		return 0, tagError(ErrSinkUnavailable, err)
 	}
 	var c Compound
 	if searchResults.Hits.TotalHits.Value > 0 {
 		for _, hit := range searchResults.Hits.Hits {
 			err := json.Unmarshal(hit.Source, &c)
 			if err != nil {
-				m := fmt.Sprint("Error deserialize", err)
+				m := fmt.Sprint("Error deserialize ", err)
 				fmt.Println(m)
-				l.Fatal(m)
+				l.Error(m)
 				return 0, err
 			}
 			return c.UCI, nil
@@ -295,20 +315,20 @@ func (em *ElasticManager) getLastUpdated() (time.Time, error) {
 	aggCtAt := elastic.NewMaxAggregation().Field("sources.created_at")
 	searchResults, err := em.Client.Search().Index(em.IndexName).Query(termQuery).Aggregation("max_last_updated", aggLstUp).Aggregation("max_created", aggCtAt).Do(ctx)
 	if err != nil {
-		m := fmt.Sprint("Error getting getting last updated UCI", err)
+		m := fmt.Sprint("Error getting getting last updated UCI ", err)
 		fmt.Println(m)
-		l.Fatal(m)
+		l.Error(m)
 
-		return time.Now(), err
+		return time.Now(), tagError(ErrSinkUnavailable, err)
 	}
 
 	maxLastUpdated, found := searchResults.Aggregations.MaxBucket("max_last_updated")
 	if !found {
-		m := fmt.Sprint("max_last_updated aggregation not found", err)
+		m := "max_last_updated aggregation not found"
 		fmt.Println(m)
-		l.Fatal(m)
+		l.Error(m)
 
-		return time.Now(), err
+		return time.Now(), errors.New(m)
 	}
 	l.Debug("Max last updated", maxLastUpdated.ValueAsString)
 	tm := int64(*maxLastUpdated.Value) / 1000
@@ -316,11 +336,11 @@ func (em *ElasticManager) getLastUpdated() (time.Time, error) {
 
 	maxCreated, found := searchResults.Aggregations.MaxBucket("max_created")
 	if !found {
-		m := fmt.Sprint("max_created aggregation not found", err)
+		m := "max_created aggregation not found"
 		fmt.Println(m)
-		l.Fatal(m)
+		l.Error(m)
 
-		return time.Now(), err
+		return time.Now(), errors.New(m)
 	}
 	l.Debug("Max Created", maxCreated.ValueAsString)
 	tm = int64(*maxCreated.Value) / 1000
@@ -345,20 +365,20 @@ func (em *ElasticManager) getUCICountBySources() (map[int]UCICount, error) {
 	aggUCISou := elastic.NewTermsAggregation().Field("sources.id").Size(3000).OrderByCountDesc()
 	searchResults, err := em.Client.Search().Index(em.IndexName).Size(0).Aggregation("uci_by_sources_count", aggUCISou).Do(ctx)
 	if err != nil {
-		m := fmt.Sprint("Error getting getting last updated UCI", err)
+		m := fmt.Sprint("Error getting UCI count by sources ", err)
 		fmt.Println(m)
-		l.Fatal(m)
+		l.Error(m)
 
-		return nil, err
+		return nil, tagError(ErrSinkUnavailable, err)
 	}
 
 	uciCountAgg, found := searchResults.Aggregations.Terms("uci_by_sources_count")
 	if !found {
-		m := fmt.Sprint("uci_by_sources_count aggregation not found", err)
+		m := "uci_by_sources_count aggregation not found"
 		fmt.Println(m)
-		l.Fatal(m)
+		l.Error(m)
 
-		return nil, err
+		return nil, errors.New(m)
 	}
 
 	uca := make(map[int]UCICount)
@@ -378,7 +398,101 @@ func (em *ElasticManager) getUCICountBySources() (map[int]UCICount, error) {
 	return uca, err
 }
 
+// loadSettings index settings disabled for the duration of a full load, nil
+// values are restored as null, back to the cluster default
+type loadSettings struct {
+	RefreshInterval  *string `json:"refresh_interval"`
+	NumberOfReplicas *string `json:"number_of_replicas"`
+}
+
+// leftover whether refresh is disabled, which may be left by a load aborted
+// without a checkpoint. The settings are restored as captured all the same
+func (ls loadSettings) leftover() bool {
+	return ls.RefreshInterval != nil && *ls.RefreshInterval == "-1"
+}
+
+// getLoadSettings the refresh interval and replicas currently set on the index
+func (em *ElasticManager) getLoadSettings(ctx context.Context) (loadSettings, error) {
+	var ls loadSettings
+	res, err := em.Client.IndexGetSettings(em.IndexName).FlatSettings(true).Do(ctx)
+	if err != nil {
+		return ls, tagError(ErrSinkUnavailable, err)
+	}
+	// An alias answers with its concrete index
+	for _, r := range res {
+		if v, ok := r.Settings["index.refresh_interval"].(string); ok {
+			ls.RefreshInterval = &v
+		}
+		if v, ok := r.Settings["index.number_of_replicas"].(string); ok {
+			ls.NumberOfReplicas = &v
+		}
+		break
+	}
+	return ls, nil
+}
+
+// beginLoad disables refreshes and replicas on the index, original holds the
+// settings to restore with endLoad
+func (em *ElasticManager) beginLoad(ctx context.Context, original loadSettings) error {
+	l := em.logger
+	if original.leftover() {
+		m := fmt.Sprintf("Refresh already disabled on %s and restored as such after the load, reset refresh_interval and number_of_replicas if an aborted load left them", em.IndexName)
+		fmt.Println(m)
+		l.Warn(m)
+	}
+
+	m := fmt.Sprintf("Disabling refresh and replicas of %s for the load", em.IndexName)
+	fmt.Println(m)
+	l.Info(m)
+	_, err := em.Client.IndexPutSettings(em.IndexName).BodyJson(map[string]interface{}{
+		"index": map[string]interface{}{"refresh_interval": "-1", "number_of_replicas": 0},
+	}).Do(ctx)
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+	return nil
+}
+
+// endLoad restores the settings captured before the load, then force merges,
+// unless merge is false, and refreshes the index
+func (em *ElasticManager) endLoad(ctx context.Context, original loadSettings, merge bool) error {
+	l := em.logger
+
+	m := fmt.Sprintf("Restoring refresh interval %s and replicas %s of %s", settingValue(original.RefreshInterval), settingValue(original.NumberOfReplicas), em.IndexName)
+	fmt.Println(m)
+	l.Info(m)
+	_, err := em.Client.IndexPutSettings(em.IndexName).BodyJson(map[string]interface{}{
+		"index": original,
+	}).Do(ctx)
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+
+	if merge {
+		l.Infof("Force merging %s", em.IndexName)
+		_, err = em.Client.Forcemerge(em.IndexName).Do(ctx)
+		if err != nil {
+			return tagError(ErrSinkRejected, err)
+		}
+	}
+
+	l.Infof("Refreshing %s", em.IndexName)
+	_, err = em.Client.Refresh(em.IndexName).Do(ctx)
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+	return nil
+}
+
+func settingValue(v *string) string {
+	if v == nil {
+		return "default"
+	}
+	return *v
+}
+
 //Close terminates the ElasticSearch Client and BulkProcessor
-func (em *ElasticManager) Close() {
+func (em *ElasticManager) Close() error {
 	em.Client.Stop()
+	return nil
 }
@@ -0,0 +1,158 @@
+package extractor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// mappingFields flattens the properties of an index mapping into field path ->
+// type, objects without an explicit type are reported as "object"
+func mappingFields(properties map[string]interface{}, prefix string, fields map[string]string) {
+	for name, p := range properties {
+		prop, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := prefix + name
+		t, _ := prop["type"].(string)
+		if sub, ok := prop["properties"].(map[string]interface{}); ok {
+			if len(t) == 0 {
+				t = "object"
+			}
+			mappingFields(sub, path+".", fields)
+		}
+		fields[path] = t
+	}
+}
+
+// mappingProperties the properties of a mapping, either typeless (7.x) or
+// under a single document type
+func mappingProperties(mappings map[string]interface{}) map[string]interface{} {
+	if p, ok := mappings["properties"].(map[string]interface{}); ok {
+		return p
+	}
+	if len(mappings) == 1 {
+		for _, m := range mappings {
+			if tm, ok := m.(map[string]interface{}); ok {
+				p, _ := tm["properties"].(map[string]interface{})
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// configuredMapping the mappings of an index settings body
+func configuredMapping(settings string) (map[string]interface{}, error) {
+	var body struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	err := json.Unmarshal([]byte(settings), &body)
+	if err != nil {
+		return nil, fmt.Errorf("index settings: %w", err)
+	}
+	return body.Mappings, nil
+}
+
+// diffMappings lists the configured fields missing from the live mapping or
+// mapped with a different type there. Fields only on the live mapping are fine,
+// the documents don't send them
+func diffMappings(configured, live map[string]interface{}) []string {
+	cf := map[string]string{}
+	lf := map[string]string{}
+	mappingFields(mappingProperties(configured), "", cf)
+	mappingFields(mappingProperties(live), "", lf)
+
+	var diff []string
+	for path, t := range cf {
+		lt, ok := lf[path]
+		if i := strings.LastIndex(path, "."); !ok && i >= 0 {
+			if _, pok := lf[path[:i]]; !pok {
+				// Already reported with its missing parent
+				continue
+			}
+		}
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s: %s configured, missing on the index", path, t))
+			continue
+		}
+		if lt != t {
+			diff = append(diff, fmt.Sprintf("%s: %s configured, %s on the index", path, t, lt))
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// getMapping the live mappings of an index or alias, nil when it doesn't exist
+func (c *restClient) getMapping(ctx context.Context, index string) (map[string]interface{}, error) {
+	var res map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	code, err := c.do(ctx, http.MethodGet, "/"+index+"/_mapping", nil, "", &res)
+	if err != nil || code == http.StatusNotFound {
+		return nil, err
+	}
+	// An alias answers with its concrete index
+	for _, m := range res {
+		return m.Mappings, nil
+	}
+	return nil, nil
+}
+
+// MappingDriftError the configured fields missing from the live mapping of an
+// index or mapped with another type there, it matches ErrConfig
+type MappingDriftError struct {
+	Index  string
+	Fields []string
+}
+
+func (e *MappingDriftError) Error() string {
+	return fmt.Sprintf("index %s mapping differs from the index settings, run migrate to reindex it:\n  - %s", e.Index, strings.Join(e.Fields, "\n  - "))
+}
+
+func (e *MappingDriftError) Is(target error) bool {
+	return target == ErrConfig
+}
+
+// checkMappingDrift compares the live mapping of index with the one of the
+// index settings. Indices yet to be created have nothing to compare
+func checkMappingDrift(ctx context.Context, conf *Configuration, index string) error {
+	c := newRestClient(conf.ElasticHost, conf.ElasticAuth)
+	defer c.http.CloseIdleConnections()
+
+	live, err := c.getMapping(ctx, index)
+	if err != nil {
+		return tagError(ErrSinkUnavailable, err)
+	}
+	if live == nil {
+		return nil
+	}
+	configured, err := configuredMapping(conf.IndexSettings())
+	if err != nil {
+		return tagError(ErrConfig, err)
+	}
+	if d := diffMappings(configured, live); len(d) > 0 {
+		return &MappingDriftError{Index: index, Fields: d}
+	}
+	return nil
+}
+
+// refuseMappingDrift stops Elasticsearch and OpenSearch runs before anything is
+// written into an index whose mapping drifted from the configured one
+func refuseMappingDrift(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) error {
+	if conf.SinkName() != "elasticsearch" && conf.SinkName() != "opensearch" {
+		return nil
+	}
+	err := checkMappingDrift(ctx, conf, conf.IndexName())
+	if err != nil {
+		l.Error("Refusing to run, the mapping of the index can't be checked or drifted")
+	}
+	return err
+}
@@ -0,0 +1,259 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MigrateOptions how Migrate treats an index that already matches the
+// configuration or isn't behind an alias
+type MigrateOptions struct {
+	// Force reindexes even when the live mapping has no drift
+	Force bool
+	// ReplaceIndex deletes the index when the index name is a concrete index and
+	// not an alias, so the alias can take its name. Otherwise Migrate stops once
+	// the copy is done
+	ReplaceIndex bool
+}
+
+const reindexPollInterval = 10 * time.Second
+
+// Migrate reindexes the documents of the index into a new versioned index created
+// with the index settings and moves the alias to it once the counts match. Writes
+// into the old index are blocked while it's copied, it's left for rollback
+func Migrate(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, opts MigrateOptions) error {
+	if conf.SinkName() != "elasticsearch" && conf.SinkName() != "opensearch" {
+		m := fmt.Sprintf("Migrate reindexes Elasticsearch and OpenSearch indices, it can't be used with the %s sink", conf.SinkName())
+		fmt.Println(m)
+		l.Error(m)
+		return fmt.Errorf("%w: %s", ErrConfig, m)
+	}
+
+	c := newRestClient(conf.ElasticHost, conf.ElasticAuth)
+	defer c.http.CloseIdleConnections()
+	alias := conf.IndexName()
+
+	err := checkMappingDrift(ctx, conf, alias)
+	var drift *MappingDriftError
+	switch {
+	case errors.As(err, &drift):
+		for _, f := range drift.Fields {
+			l.Info("Mapping drift ", f)
+		}
+	case err != nil:
+		return err
+	case !opts.Force:
+		m := fmt.Sprintf("Index %s mapping matches the index settings, nothing to migrate. Use --force to reindex anyway", alias)
+		fmt.Println(m)
+		l.Info(m)
+		return nil
+	}
+
+	current, err := c.aliasIndices(ctx, alias)
+	if err != nil {
+		return tagError(ErrSinkUnavailable, err)
+	}
+	concrete := false
+	if current == nil {
+		concrete, err = c.indexExists(ctx, alias)
+		if err != nil {
+			return tagError(ErrSinkUnavailable, err)
+		}
+		if !concrete {
+			m := fmt.Sprintf("Index %s doesn't exist, there's nothing to migrate", alias)
+			fmt.Println(m)
+			l.Error(m)
+			return fmt.Errorf("%w: %s", ErrConfig, m)
+		}
+		current = []string{alias}
+	}
+
+	index := migrationIndex(alias, time.Now())
+	m := fmt.Sprintf("Creating index %s to migrate %s into", index, alias)
+	fmt.Println(m)
+	l.Info(m)
+	err = c.createIndex(ctx, index, conf.IndexSettings())
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+
+	// Documents written during the copy would be missing from it
+	l.Infof("Blocking writes into %v until the migration ends", current)
+	err = c.blockWrites(ctx, current, true)
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+	removed := false
+	defer func() {
+		if removed {
+			return
+		}
+		// The run context may be canceled already, the block can't be left behind
+		uctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeoutDuration())
+		defer cancel()
+		uerr := c.blockWrites(uctx, current, false)
+		if uerr != nil {
+			m := fmt.Sprintf("Error unblocking writes into %v, reset index.blocks.write on them: %s", current, uerr)
+			fmt.Println(m)
+			l.Error(m)
+		}
+	}()
+
+	err = c.reindex(ctx, l, alias, index)
+	if err != nil {
+		m := fmt.Sprintf("Reindex of %s into %s failed, %s is left as it was: %s", alias, index, alias, err)
+		fmt.Println(m)
+		l.Error(m)
+		return err
+	}
+
+	from, err := c.count(ctx, alias)
+	if err != nil {
+		return tagError(ErrSinkUnavailable, err)
+	}
+	to, err := c.count(ctx, index)
+	if err != nil {
+		return tagError(ErrSinkUnavailable, err)
+	}
+	if from != to {
+		m := fmt.Sprintf("%s holds %d documents and %s %d, %s is left as it was", alias, from, index, to, alias)
+		fmt.Println(m)
+		l.Error(m)
+		return fmt.Errorf("%w: %s", ErrCountMismatch, index)
+	}
+	l.Infof("%d documents copied from %s into %s", to, alias, index)
+
+	if concrete && !opts.ReplaceIndex {
+		m := fmt.Sprintf("%s is an index, not an alias. %s holds its copy, run migrate with --replace-index to delete %s and point an alias with its name to %s", alias, index, alias, index)
+		fmt.Println(m)
+		l.Warn(m)
+		return nil
+	}
+
+	var actions []map[string]map[string]string
+	for _, cu := range current {
+		if concrete {
+			actions = append(actions, map[string]map[string]string{"remove_index": {"index": cu}})
+		} else {
+			actions = append(actions, map[string]map[string]string{"remove": {"index": cu, "alias": alias}})
+		}
+	}
+	actions = append(actions, map[string]map[string]string{"add": {"index": index, "alias": alias}})
+	err = c.updateAliases(ctx, actions)
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+	removed = concrete
+	m = fmt.Sprintf("Alias %s moved from %v to %s", alias, current, index)
+	if concrete {
+		m = fmt.Sprintf("Index %s replaced by alias %s to %s", alias, alias, index)
+	}
+	fmt.Println(m)
+	l.Info(m)
+	return nil
+}
+
+// migrationIndex the index a migration started at t copies into, its release
+// never matches the one of a load started the same day
+func migrationIndex(alias string, t time.Time) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s-migrate_%s", alias, t.Format("20060102"), t.Format("150405")))
+}
+
+// blockWrites sets, or resets, index.blocks.write on the indices
+func (c *restClient) blockWrites(ctx context.Context, indices []string, block bool) error {
+	var v interface{}
+	if block {
+		v = true
+	}
+	body, err := json.Marshal(map[string]interface{}{"index.blocks.write": v})
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPut, "/"+strings.Join(indices, ",")+"/_settings", bytes.NewReader(body), "application/json", nil)
+	return err
+}
+
+// reindexTask the _tasks answer for a reindex started without waiting
+type reindexTask struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status struct {
+			Total   int `json:"total"`
+			Created int `json:"created"`
+			Updated int `json:"updated"`
+		} `json:"status"`
+	} `json:"task"`
+	Error    map[string]interface{} `json:"error"`
+	Response struct {
+		Failures []interface{} `json:"failures"`
+	} `json:"response"`
+}
+
+// reindex copies the documents of source into dest as a task, polled until it
+// completes so long copies don't hang on a single request
+func (c *restClient) reindex(ctx context.Context, l *zap.SugaredLogger, source, dest string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"source": map[string]string{"index": source},
+		"dest":   map[string]string{"index": dest},
+	})
+	if err != nil {
+		return err
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	_, err = c.do(ctx, http.MethodPost, "/_reindex?wait_for_completion=false", bytes.NewReader(body), "application/json", &started)
+	if err != nil {
+		return tagError(ErrSinkRejected, err)
+	}
+	l.Infof("Reindex task %s started", started.Task)
+
+	for {
+		var t reindexTask
+		_, err = c.do(ctx, http.MethodGet, "/_tasks/"+started.Task, nil, "", &t)
+		if err != nil {
+			return tagError(ErrSinkUnavailable, err)
+		}
+		st := t.Task.Status
+		if t.Completed {
+			if t.Error != nil {
+				return fmt.Errorf("%w: reindex task %s: %v", ErrSinkRejected, started.Task, t.Error["reason"])
+			}
+			if len(t.Response.Failures) > 0 {
+				return fmt.Errorf("%w: reindex task %s: %d failures, first %v", ErrSinkRejected, started.Task, len(t.Response.Failures), t.Response.Failures[0])
+			}
+			return nil
+		}
+		m := fmt.Sprintf("Reindexing %s into %s: %d of %d documents", source, dest, st.Created+st.Updated, st.Total)
+		fmt.Println(m)
+		l.Info(m)
+
+		select {
+		case <-ctx.Done():
+			l.Warnf("Reindex task %s keeps running on the cluster, cancel it with POST _tasks/%s/_cancel", started.Task, started.Task)
+			return ErrInterrupted
+		case <-time.After(reindexPollInterval):
+		}
+	}
+}
+
+// count the documents of an index after refreshing it
+func (c *restClient) count(ctx context.Context, index string) (int, error) {
+	_, err := c.do(ctx, http.MethodPost, "/"+index+"/_refresh", nil, "", nil)
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		Count int `json:"count"`
+	}
+	_, err = c.do(ctx, http.MethodGet, "/"+index+"/_count", nil, "", &res)
+	return res.Count, err
+}
@@ -0,0 +1,126 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"go.uber.org/zap"
+)
+
+// fakeCluster answers the requests of a migration of the unichem alias, on
+// index unichem-20260101-1, and records them. count is the document count of
+// the new index
+type fakeCluster struct {
+	mu       sync.Mutex
+	requests []string
+	count    int
+}
+
+func (fc *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	fc.mu.Lock()
+	fc.requests = append(fc.requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(b)))
+	fc.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/unichem/_mapping":
+		fmt.Fprint(w, `{"unichem-20260101-1": {"mappings": {"properties": {}}}}`)
+	case r.URL.Path == "/_alias/unichem":
+		fmt.Fprint(w, `{"unichem-20260101-1": {"aliases": {"unichem": {}}}}`)
+	case r.URL.Path == "/_reindex":
+		fmt.Fprint(w, `{"task": "node:1"}`)
+	case strings.HasPrefix(r.URL.Path, "/_tasks/"):
+		fmt.Fprint(w, `{"completed": true}`)
+	case r.URL.Path == "/unichem/_count":
+		fmt.Fprint(w, `{"count": 10}`)
+	case strings.HasSuffix(r.URL.Path, "/_count"):
+		fmt.Fprintf(w, `{"count": %d}`, fc.count)
+	default:
+		fmt.Fprint(w, `{"acknowledged": true}`)
+	}
+}
+
+// settings the _settings requests received, in order
+func (fc *fakeCluster) settings() []string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	var s []string
+	for _, r := range fc.requests {
+		if strings.Contains(r, "/_settings") {
+			s = append(s, r)
+		}
+	}
+	return s
+}
+
+func TestMigrationIndex(t *testing.T) {
+	at := time.Date(2026, 10, 16, 15, 30, 0, 0, time.UTC)
+	load := BlueGreen{Release: "153000"}.versionedIndex("unichem", at)
+	migration := migrationIndex("unichem", at)
+	if migration == load {
+		t.Errorf("migration index %s is the load one", migration)
+	}
+	if !isVersionedIndex("unichem", migration) {
+		t.Errorf("migration index %s not pruned as a versioned index", migration)
+	}
+}
+
+func TestMigrateBlocksWritesDuringTheCopy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		count   int
+		wantErr bool
+	}{
+		{"copied", 10, false},
+		{"count mismatch", 9, true},
+	} {
+		fc := &fakeCluster{count: tc.count}
+		srv := httptest.NewServer(fc)
+		conf := &Configuration{Sink: "elasticsearch", ElasticHost: srv.URL, Index: "unichem"}
+
+		err := Migrate(context.Background(), zap.NewNop().Sugar(), conf, MigrateOptions{})
+		srv.Close()
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: got error %v", tc.name, err)
+		}
+
+		want := []string{
+			`PUT /unichem-20260101-1/_settings {"index.blocks.write":true}`,
+			`PUT /unichem-20260101-1/_settings {"index.blocks.write":null}`,
+		}
+		if got := fc.settings(); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got settings requests %q, want %q", tc.name, got, want)
+		}
+	}
+}
+
+func TestEndLoadRestoresTheCapturedSettings(t *testing.T) {
+	fc := &fakeCluster{}
+	srv := httptest.NewServer(fc)
+	defer srv.Close()
+	client, err := elastic.NewClient(elastic.SetURL(srv.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	em := &ElasticManager{logger: zap.NewNop().Sugar(), Client: client, IndexName: "unichem"}
+
+	// Refresh disabled and no replicas on purpose, or left by an aborted load
+	refresh, replicas := "-1", "0"
+	err = em.endLoad(context.Background(), loadSettings{RefreshInterval: &refresh, NumberOfReplicas: &replicas}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`PUT /unichem/_settings {"index":{"refresh_interval":"-1","number_of_replicas":"0"}}`}
+	if got := fc.settings(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got settings requests %q, want %q", got, want)
+	}
+}
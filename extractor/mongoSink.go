@@ -0,0 +1,179 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MongoSink upserts whole Compound documents into a MongoDB collection, keyed
+// (_id) by UCI. Documents are replaced, so sources or components no longer
+// present are dropped. Batches of Bulklimit compounds are sent as unordered bulk writes
+type MongoSink struct {
+	logger           *zap.SugaredLogger
+	Context          context.Context
+	client           *mongo.Client
+	collection       *mongo.Collection
+	Bulklimit        int
+	MaxBulkCalls     int
+	models           []mongo.WriteModel
+	ucis             []int
+	currentBulkCalls int
+	WaitGroup        sync.WaitGroup
+	totalSentJobs    int64
+	respchan         chan WorkerResponse
+	errchan          chan error
+}
+
+// NewMongoSink connects to the configured MongoDB and compounds collection
+func NewMongoSink(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) (*MongoSink, error) {
+	if conf.BulkLimit <= 0 || conf.MaxBulkCalls <= 0 {
+		return nil, fmt.Errorf("%w: BulkLimit and MaxBulkCalls must be numbers higher than 0", ErrConfig)
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(conf.MongoDB))
+	if err != nil {
+		return nil, tagError(ErrSinkUnavailable, err)
+	}
+	l.Debug("Connected to Mongo")
+
+	return &MongoSink{
+		logger:       l,
+		Context:      ctx,
+		client:       client,
+		collection:   client.Database(conf.MongoDatabaseName()).Collection(conf.MongoCompoundCollectionName()),
+		Bulklimit:    conf.BulkLimit,
+		MaxBulkCalls: conf.MaxBulkCalls,
+		respchan:     make(chan WorkerResponse),
+		errchan:      make(chan error),
+	}, nil
+}
+
+// Add queues the compound replacement, sending the batch through a worker once
+// Bulklimit is reached
+func (ms *MongoSink) Add(c Compound) error {
+	ms.models = append(ms.models, mongo.NewReplaceOneModel().
+		SetFilter(bson.D{{Key: "_id", Value: c.UCI}}).
+		SetReplacement(c).
+		SetUpsert(true))
+	ms.ucis = append(ms.ucis, c.UCI)
+
+	if len(ms.models) < ms.Bulklimit {
+		return nil
+	}
+
+	if ms.currentBulkCalls < ms.MaxBulkCalls {
+		ms.currentBulkCalls++
+	} else {
+		// Wait for the MaxBulkCalls workers to finish before continuing
+		ms.logger.Debugf("Hitting %d workers to send. Waiting for them to finish. Last UCI: %d", ms.currentBulkCalls, c.UCI)
+		ms.WaitGroup.Wait()
+		ms.currentBulkCalls = 1
+	}
+
+	batch := int(atomic.AddInt64(&ms.totalSentJobs, 1))
+	models, ucis := ms.models, ms.ucis
+	ms.models, ms.ucis = nil, nil
+
+	ms.WaitGroup.Add(1)
+	go func() {
+		defer ms.WaitGroup.Done()
+		ms.logger.Debugf("INIT mongo worker %d", c.UCI)
+		wr, err := ms.write(models, ucis)
+		if err != nil {
+			ms.errchan <- err
+			return
+		}
+		wr.Batch = batch
+		ms.respchan <- wr
+		ms.logger.Debugf("END mongo worker %d", c.UCI)
+	}()
+	return nil
+}
+
+// write sends the bulk write, documents rejected by MongoDB are reported as
+// failed items of the WorkerResponse
+func (ms *MongoSink) write(models []mongo.WriteModel, ucis []int) (WorkerResponse, error) {
+	res, err := ms.collection.BulkWrite(ms.Context, models, options.BulkWrite().SetOrdered(false))
+
+	var bwe mongo.BulkWriteException
+	if err != nil && !errors.As(err, &bwe) {
+		return WorkerResponse{}, err
+	}
+
+	failed := make(map[int]string)
+	for _, we := range bwe.WriteErrors {
+		failed[we.Index] = we.Message
+	}
+
+	wr := WorkerResponse{Errors: len(failed) > 0}
+	if res != nil {
+		wr.Created = int(res.UpsertedCount)
+		wr.Updated = int(res.ModifiedCount)
+	}
+	for i, uci := range ucis {
+		id := strconv.Itoa(uci)
+		if reason, ok := failed[i]; ok {
+			wr.Failed++
+			wr.FailedItems = append(wr.FailedItems, FailedItem{ID: id, Reason: reason})
+			continue
+		}
+		wr.Succeeded++
+		wr.Indexed++
+		wr.LastSucceededID = id
+	}
+	return wr, nil
+}
+
+// Flush sends the current batch regardless the Bulklimit has been reached or not
+func (ms *MongoSink) Flush() error {
+	if len(ms.models) == 0 {
+		ms.logger.Warn("No compounds on current mongo batch, skipping last batch")
+		return nil
+	}
+
+	batch := int(atomic.AddInt64(&ms.totalSentJobs, 1))
+	wr, err := ms.write(ms.models, ms.ucis)
+	ms.models, ms.ucis = nil, nil
+	if err != nil {
+		return err
+	}
+
+	wr.Batch = batch
+	ms.respchan <- wr
+	ms.logger.Debug("END last mongo batch sent")
+	return nil
+}
+
+// Close disconnects from MongoDB
+func (ms *MongoSink) Close() error {
+	return ms.client.Disconnect(context.Background())
+}
+
+// Responses channel where every bulk write result is reported
+func (ms *MongoSink) Responses() <-chan WorkerResponse {
+	return ms.respchan
+}
+
+// Errors channel where failed bulk writes are reported
+func (ms *MongoSink) Errors() <-chan error {
+	return ms.errchan
+}
+
+// Sent number of bulk writes dispatched
+func (ms *MongoSink) Sent() int {
+	return int(atomic.LoadInt64(&ms.totalSentJobs))
+}
+
+// Wait blocks until the bulk write workers are done
+func (ms *MongoSink) Wait() {
+	ms.WaitGroup.Wait()
+}
@@ -0,0 +1,315 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// restClient talks the REST API shared by Elasticsearch 7/8 and OpenSearch 1/2,
+// without the version checks done by the olivere client
+type restClient struct {
+	host string
+	auth ElasticAuth
+	http *http.Client
+}
+
+// restTimeout how long a request, its response body included, may take. A bulk
+// stuck on an unresponsive cluster fails its partition instead of hanging it
+const restTimeout = 5 * time.Minute
+
+func newRestClient(host string, auth ElasticAuth) *restClient {
+	return &restClient{
+		host: strings.TrimRight(host, "/"),
+		auth: auth,
+		http: &http.Client{Timeout: restTimeout},
+	}
+}
+
+// do sends the request and decodes the JSON response into out, when given.
+// Status codes other than 2xx and 404 are returned as errors
+func (c *restClient) do(ctx context.Context, method, path string, body io.Reader, contentType string, out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, body)
+	if err != nil {
+		return 0, err
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(c.auth.Username) > 0 {
+		req.SetBasicAuth(c.auth.Username, c.auth.Password)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		return res.StatusCode, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		return res.StatusCode, fmt.Errorf("%s %s: %s %s", method, path, res.Status, string(b))
+	}
+
+	if out != nil {
+		return res.StatusCode, json.NewDecoder(res.Body).Decode(out)
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	return res.StatusCode, nil
+}
+
+func (c *restClient) indexExists(ctx context.Context, index string) (bool, error) {
+	code, err := c.do(ctx, http.MethodHead, "/"+index, nil, "", nil)
+	if err != nil {
+		return false, err
+	}
+	return code != http.StatusNotFound, nil
+}
+
+func (c *restClient) createIndex(ctx context.Context, index, body string) error {
+	var res struct {
+		Acknowledged bool `json:"acknowledged"`
+	}
+	_, err := c.do(ctx, http.MethodPut, "/"+index, strings.NewReader(body), "application/json", &res)
+	if err != nil {
+		return err
+	}
+	if !res.Acknowledged {
+		return fmt.Errorf("index %s creation not acknowledged", index)
+	}
+	return nil
+}
+
+// updateAliases applies the add/remove actions in a single, atomic, request
+func (c *restClient) updateAliases(ctx context.Context, actions []map[string]map[string]string) error {
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPost, "/_aliases", bytes.NewReader(body), "application/json", nil)
+	return err
+}
+
+type restBulkResponse struct {
+	Took   int  `json:"took"`
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Result string `json:"result"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (c *restClient) bulk(ctx context.Context, body []byte) (*restBulkResponse, error) {
+	var res restBulkResponse
+	_, err := c.do(ctx, http.MethodPost, "/_bulk", bytes.NewReader(body), "application/x-ndjson", &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r *restBulkResponse) workerResponse() WorkerResponse {
+	wr := WorkerResponse{
+		Took:   r.Took,
+		Errors: r.Errors,
+	}
+	for _, item := range r.Items {
+		for _, it := range item {
+			if it.Status >= 200 && it.Status <= 299 {
+				wr.Succeeded++
+				wr.Indexed++
+				wr.LastSucceededID = it.ID
+				switch it.Result {
+				case "created":
+					wr.Created++
+				case "updated":
+					wr.Updated++
+				case "deleted":
+					wr.Deleted++
+				}
+				continue
+			}
+			wr.Failed++
+			fi := FailedItem{ID: it.ID}
+			if it.Error != nil {
+				fi.Reason = it.Error.Reason
+			}
+			wr.FailedItems = append(wr.FailedItems, fi)
+		}
+	}
+	return wr
+}
+
+// OpenSearchSink upserts compounds by UCI through the plain _bulk API, it works
+// against Elasticsearch 7/8 and OpenSearch 1/2
+type OpenSearchSink struct {
+	logger           *zap.SugaredLogger
+	Context          context.Context
+	client           *restClient
+	IndexName        string
+	TypeName         string
+	Bulklimit        int
+	MaxBulkCalls     int
+	buf              bytes.Buffer
+	count            int
+	currentBulkCalls int
+	WaitGroup        sync.WaitGroup
+	totalSentJobs    int64
+	respchan         chan WorkerResponse
+	errchan          chan error
+}
+
+// NewOpenSearchSink creates the index with the configured settings when it doesn't exist
+func NewOpenSearchSink(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, index string) (*OpenSearchSink, error) {
+	if conf.BulkLimit <= 0 || conf.MaxBulkCalls <= 0 {
+		return nil, fmt.Errorf("%w: BulkLimit and MaxBulkCalls must be numbers higher than 0", ErrConfig)
+	}
+
+	ss := &OpenSearchSink{
+		logger:       l,
+		Context:      ctx,
+		client:       newRestClient(conf.ElasticHost, conf.ElasticAuth),
+		IndexName:    index,
+		TypeName:     conf.TypeName(),
+		Bulklimit:    conf.BulkLimit,
+		MaxBulkCalls: conf.MaxBulkCalls,
+		respchan:     make(chan WorkerResponse),
+		errchan:      make(chan error),
+	}
+
+	ex, err := ss.client.indexExists(ctx, index)
+	if err != nil {
+		return nil, tagError(ErrSinkUnavailable, err)
+	}
+	if ex {
+		l.Infof("Index %s exist, skipping its creation", index)
+		return ss, nil
+	}
+
+	l.Infof("Creating index %s", index)
+	err = ss.client.createIndex(ctx, index, conf.IndexSettings())
+	if err != nil {
+		return nil, tagError(ErrSinkRejected, err)
+	}
+	return ss, nil
+}
+
+// Add appends the compound upsert to the current bulk, sending it through a
+// worker once Bulklimit is reached
+func (ss *OpenSearchSink) Add(c Compound) error {
+	enc := json.NewEncoder(&ss.buf)
+	err := enc.Encode(bulkAction{Update: bulkActionMeta{Index: ss.IndexName, Type: ss.TypeName, ID: strconv.Itoa(c.UCI)}})
+	if err != nil {
+		return err
+	}
+	err = enc.Encode(bulkUpsert{Doc: c, DocAsUpsert: true})
+	if err != nil {
+		return err
+	}
+	ss.count++
+
+	if ss.count < ss.Bulklimit {
+		return nil
+	}
+
+	if ss.currentBulkCalls < ss.MaxBulkCalls {
+		ss.currentBulkCalls++
+	} else {
+		// Wait for the MaxBulkCalls workers to finish before continuing
+		ss.logger.Debugf("Hitting %d workers to send. Waiting for them to finish. Last UCI: %d", ss.currentBulkCalls, c.UCI)
+		ss.WaitGroup.Wait()
+		ss.currentBulkCalls = 1
+	}
+
+	batch := int(atomic.AddInt64(&ss.totalSentJobs, 1))
+	body := make([]byte, ss.buf.Len())
+	copy(body, ss.buf.Bytes())
+	ss.buf.Reset()
+	ss.count = 0
+
+	ss.WaitGroup.Add(1)
+	go ss.sendBulkRequest(body, batch, c.UCI)
+	return nil
+}
+
+func (ss *OpenSearchSink) sendBulkRequest(body []byte, batch, UCI int) {
+	defer ss.WaitGroup.Done()
+	ss.logger.Debugf("INIT bulk worker %d", UCI)
+	res, err := ss.client.bulk(ss.Context, body)
+	if err != nil {
+		ss.errchan <- err
+		return
+	}
+	wr := res.workerResponse()
+	wr.Batch = batch
+	ss.respchan <- wr
+	ss.logger.Debugf("END bulk worker %d", UCI)
+}
+
+// Flush sends the current bulk regardless the Bulklimit has been reached or not
+func (ss *OpenSearchSink) Flush() error {
+	if ss.count == 0 {
+		ss.logger.Warn("No actions on current bulk, skipping last bulk")
+		return nil
+	}
+
+	batch := int(atomic.AddInt64(&ss.totalSentJobs, 1))
+	res, err := ss.client.bulk(ss.Context, ss.buf.Bytes())
+	ss.buf.Reset()
+	ss.count = 0
+	if err != nil {
+		return err
+	}
+
+	wr := res.workerResponse()
+	wr.Batch = batch
+	ss.respchan <- wr
+	ss.logger.Debug("END last bulk sent")
+	return nil
+}
+
+// Close idle connections are released, pending compounds not flushed are dropped
+func (ss *OpenSearchSink) Close() error {
+	ss.client.http.CloseIdleConnections()
+	return nil
+}
+
+// Responses channel where every bulk response is reported
+func (ss *OpenSearchSink) Responses() <-chan WorkerResponse {
+	return ss.respchan
+}
+
+// Errors channel where failed bulk requests are reported
+func (ss *OpenSearchSink) Errors() <-chan error {
+	return ss.errchan
+}
+
+// Sent number of bulk requests dispatched
+func (ss *OpenSearchSink) Sent() int {
+	return int(atomic.LoadInt64(&ss.totalSentJobs))
+}
+
+// Wait blocks until the bulk workers are done
+func (ss *OpenSearchSink) Wait() {
+	ss.WaitGroup.Wait()
+}
@@ -0,0 +1,128 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeOpenSearch accepts every upsert of a _bulk but the ones of the reject
+// UCI, and records the bulk bodies
+type fakeOpenSearch struct {
+	mu     sync.Mutex
+	bulks  []string
+	reject string
+}
+
+func (fo *fakeOpenSearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/_bulk" {
+		// The index exists
+		return
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	fo.mu.Lock()
+	fo.bulks = append(fo.bulks, string(b))
+	fo.mu.Unlock()
+
+	var items []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		var action bulkAction
+		if err := json.Unmarshal(sc.Bytes(), &action); err != nil || len(action.Update.ID) == 0 {
+			continue
+		}
+		id := action.Update.ID
+		if id == fo.reject {
+			items = append(items, fmt.Sprintf(`{"update": {"_id": "%s", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}`, id))
+			continue
+		}
+		items = append(items, fmt.Sprintf(`{"update": {"_id": "%s", "status": 201, "result": "created"}}`, id))
+	}
+	fmt.Fprintf(w, `{"took": 3, "errors": %t, "items": [%s]}`, len(fo.reject) > 0, strings.Join(items, ","))
+}
+
+func TestOpenSearchSinkUpsertsEveryCompound(t *testing.T) {
+	fo := &fakeOpenSearch{}
+	srv := httptest.NewServer(fo)
+	defer srv.Close()
+
+	src := &fakeRowSource{}
+	for uci := 1; uci <= 3; uci++ {
+		src.rows = append(src.rows, Row{UCI: uci, StandardInchi: "InChI=1S/CH4/h1H4", SrcID: 1, SrcCompoundID: fmt.Sprint("ID", uci), Assignment: 1})
+	}
+	conf := &Configuration{Sink: "opensearch", ElasticHost: srv.URL, Index: "unichem", Type: "_doc", BulkLimit: 2, MaxBulkCalls: 1}
+
+	res, err := NewPipeline(src, ConfiguredSink(conf), WithRanges(Range{Start: 1, Finish: 4})).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Indexed != 3 || res.Rejected != 0 {
+		t.Errorf("got %d compounds indexed and %d rejected, want 3 and 0", res.Indexed, res.Rejected)
+	}
+
+	// Bulks may be sent in any order, each is made of update and upsert pairs
+	upserted := make(map[string]bool)
+	for _, b := range fo.bulks {
+		lines := strings.Split(strings.TrimSpace(b), "\n")
+		if len(lines)%2 != 0 {
+			t.Fatalf("got bulk %q, want an update and its upsert per compound", b)
+		}
+		for i := 0; i < len(lines); i += 2 {
+			var action bulkAction
+			var upsert struct {
+				Doc         Compound `json:"doc"`
+				DocAsUpsert bool     `json:"doc_as_upsert"`
+			}
+			if err = json.Unmarshal([]byte(lines[i]), &action); err != nil {
+				t.Fatal(err)
+			}
+			if err = json.Unmarshal([]byte(lines[i+1]), &upsert); err != nil {
+				t.Fatal(err)
+			}
+			id := action.Update.ID
+			if action.Update.Index != "unichem" || len(action.Update.Type) > 0 {
+				t.Errorf("got action %s, want an update in unichem", lines[i])
+			}
+			if !upsert.DocAsUpsert || fmt.Sprint(upsert.Doc.UCI) != id || len(upsert.Doc.Sources) != 1 {
+				t.Errorf("got upsert %s, want compound %s as upsert", lines[i+1], id)
+			}
+			upserted[id] = true
+		}
+	}
+	if len(upserted) != 3 || !upserted["1"] || !upserted["2"] || !upserted["3"] {
+		t.Errorf("got compounds %v upserted, want 1, 2 and 3", upserted)
+	}
+}
+
+func TestOpenSearchSinkRejectedItems(t *testing.T) {
+	fo := &fakeOpenSearch{reject: "2"}
+	srv := httptest.NewServer(fo)
+	defer srv.Close()
+
+	src := &fakeRowSource{}
+	for uci := 1; uci <= 3; uci++ {
+		src.rows = append(src.rows, Row{UCI: uci, StandardInchi: "InChI=1S/CH4/h1H4", SrcID: 1, Assignment: 1})
+	}
+	conf := &Configuration{Sink: "opensearch", ElasticHost: srv.URL, Index: "unichem", BulkLimit: 10, MaxBulkCalls: 1}
+
+	res, err := NewPipeline(src, ConfiguredSink(conf), WithRanges(Range{Start: 1, Finish: 4})).Run(context.Background())
+	if !errors.Is(err, ErrSinkRejected) {
+		t.Fatalf("got error %v, want the rejected compound", err)
+	}
+	if res.Rejected != 1 || res.Indexed != 2 {
+		t.Errorf("got %d compounds indexed and %d rejected, want 2 and 1", res.Indexed, res.Rejected)
+	}
+	var re *RejectedError
+	if len(res.Failures) != 1 || !errors.As(res.Failures[0], &re) || len(re.Items) != 1 || re.Items[0].ID != "2" || re.Items[0].Reason != "failed to parse" {
+		t.Errorf("got error %v, want the item of UCI 2", err)
+	}
+}
@@ -0,0 +1,329 @@
+package extractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap"
+)
+
+// parquetCompound row of the compounds table
+type parquetCompound struct {
+	UCI                   int64  `parquet:"name=uci, type=INT64"`
+	StandardInchiKey      string `parquet:"name=standard_inchi_key, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Smiles                string `parquet:"name=smiles, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Inchi                 string `parquet:"name=inchi, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Version               string `parquet:"name=version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Formula               string `parquet:"name=formula, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Connections           string `parquet:"name=connections, type=BYTE_ARRAY, convertedtype=UTF8"`
+	HAtoms                string `parquet:"name=h_atoms, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Charge                string `parquet:"name=charge, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Protons               string `parquet:"name=protons, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoDbond           string `parquet:"name=stereo_dbond, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoSP3             string `parquet:"name=stereo_sp3, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoSP3inverted     string `parquet:"name=stereo_sp3_inverted, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoType            string `parquet:"name=stereo_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsotopicAtoms         string `parquet:"name=isotopic_atoms, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsotopicExchangeableH string `parquet:"name=isotopic_exchangeable_h, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FullStereo            string `parquet:"name=full_stereo, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FullIsotopic          string `parquet:"name=full_isotopic, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Components            int32  `parquet:"name=components, type=INT32"`
+	Sources               int32  `parquet:"name=sources, type=INT32"`
+	CreatedAt             int64  `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	IsSourceless          bool   `parquet:"name=is_sourceless, type=BOOLEAN"`
+}
+
+// parquetXref row of the compound to source table
+type parquetXref struct {
+	UCI                int64  `parquet:"name=uci, type=INT64"`
+	SrcID              int32  `parquet:"name=src_id, type=INT32"`
+	CompoundID         string `parquet:"name=compound_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Name               string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LongName           string `parquet:"name=long_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ShortName          string `parquet:"name=short_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Description        string `parquet:"name=description, type=BYTE_ARRAY, convertedtype=UTF8"`
+	BaseURL            string `parquet:"name=base_url, type=BYTE_ARRAY, convertedtype=UTF8"`
+	BaseIDURLAvailable bool   `parquet:"name=base_id_url_available, type=BOOLEAN"`
+	AuxSrc             string `parquet:"name=aux_src, type=BYTE_ARRAY, convertedtype=UTF8"`
+	AuxForURL          bool   `parquet:"name=aux_for_url, type=BOOLEAN"`
+	CreatedAt          *int64 `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	LastUpdated        *int64 `parquet:"name=last_updated, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	IsPrivate          bool   `parquet:"name=is_private, type=BOOLEAN"`
+}
+
+// parquetComponent row of the InChI components table, Component is the position
+// of the component in the compound's InChI
+type parquetComponent struct {
+	UCI                   int64  `parquet:"name=uci, type=INT64"`
+	Component             int32  `parquet:"name=component, type=INT32"`
+	Inchi                 string `parquet:"name=inchi, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Formula               string `parquet:"name=formula, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Connections           string `parquet:"name=connections, type=BYTE_ARRAY, convertedtype=UTF8"`
+	HAtoms                string `parquet:"name=h_atoms, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Charge                string `parquet:"name=charge, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Protons               string `parquet:"name=protons, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoDbond           string `parquet:"name=stereo_dbond, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoSP3             string `parquet:"name=stereo_sp3, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoSP3inverted     string `parquet:"name=stereo_sp3_inverted, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StereoType            string `parquet:"name=stereo_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsotopicAtoms         string `parquet:"name=isotopic_atoms, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsotopicExchangeableH string `parquet:"name=isotopic_exchangeable_h, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FullStereo            string `parquet:"name=full_stereo, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FullIsotopic          string `parquet:"name=full_isotopic, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// parquetTables names of the tables, one directory each under the export path
+var parquetTables = []string{"compounds", "xrefs", "components"}
+
+type parquetFile struct {
+	tmpName string
+	file    *os.File
+	writer  *writer.ParquetWriter
+}
+
+// ParquetSink writes compounds, their source xrefs and their InChI components
+// into three Parquet tables. Files are partitioned by the extractor's UCI range
+// (hive style uci_range=start-finish directories) and rotated every Rotate compounds
+type ParquetSink struct {
+	logger    *zap.SugaredLogger
+	Dir       string
+	Rotate    int
+	Partition string
+	part      int
+	count     int
+	lastID    string
+	files     []*parquetFile
+	sent      int64
+	respchan  chan WorkerResponse
+	errchan   chan error
+}
+
+// NewParquetSink creates the partition directory of each table
+func NewParquetSink(l *zap.SugaredLogger, e Export, partition string) (*ParquetSink, error) {
+	rotate := e.Rotate
+	if rotate <= 0 {
+		rotate = defaultExportRotate
+	}
+
+	for _, t := range parquetTables {
+		err := os.MkdirAll(filepath.Join(e.Path, t, "uci_range="+partition), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ParquetSink{
+		logger:    l,
+		Dir:       e.Path,
+		Rotate:    rotate,
+		Partition: partition,
+		respchan:  make(chan WorkerResponse),
+		errchan:   make(chan error),
+	}, nil
+}
+
+// Add writes the compound into the three tables, rotating the files when full
+func (ps *ParquetSink) Add(c Compound) error {
+	if ps.files == nil {
+		err := ps.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ps.files[0].writer.Write(parquetCompound{
+		UCI:                   int64(c.UCI),
+		StandardInchiKey:      c.StandardInchiKey,
+		Smiles:                c.Smiles,
+		Inchi:                 c.Inchi.Inchi,
+		Version:               c.Inchi.Version,
+		Formula:               c.Inchi.Formula,
+		Connections:           c.Inchi.Connections,
+		HAtoms:                c.Inchi.HAtoms,
+		Charge:                c.Inchi.Charge,
+		Protons:               c.Inchi.Protons,
+		StereoDbond:           c.Inchi.StereoDbond,
+		StereoSP3:             c.Inchi.StereoSP3,
+		StereoSP3inverted:     c.Inchi.StereoSP3inverted,
+		StereoType:            c.Inchi.StereoType,
+		IsotopicAtoms:         c.Inchi.IsotopicAtoms,
+		IsotopicExchangeableH: c.Inchi.IsotopicExchangeableH,
+		FullStereo:            c.Inchi.FullStereo,
+		FullIsotopic:          c.Inchi.FullIsotopic,
+		Components:            int32(len(c.Components)),
+		Sources:               int32(len(c.Sources)),
+		CreatedAt:             c.CreatedAt.UnixMilli(),
+		IsSourceless:          c.IsSourceless,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range c.Sources {
+		err := ps.files[1].writer.Write(parquetXref{
+			UCI:                int64(c.UCI),
+			SrcID:              int32(s.ID),
+			CompoundID:         s.CompoundID,
+			Name:               s.Name,
+			LongName:           s.LongName,
+			ShortName:          s.ShortName,
+			Description:        s.Description,
+			BaseURL:            s.BaseURL,
+			BaseIDURLAvailable: s.BaseIDURLAvailable,
+			AuxSrc:             s.AuxSrc,
+			AuxForURL:          s.AuxForURL,
+			CreatedAt:          parquetTime(s.CreatedAt),
+			LastUpdated:        parquetTime(s.LastUpdate),
+			IsPrivate:          s.IsPrivate,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, in := range c.Components {
+		err := ps.files[2].writer.Write(parquetComponent{
+			UCI:                   int64(c.UCI),
+			Component:             int32(i),
+			Inchi:                 in.Inchi,
+			Formula:               in.Formula,
+			Connections:           in.Connections,
+			HAtoms:                in.HAtoms,
+			Charge:                in.Charge,
+			Protons:               in.Protons,
+			StereoDbond:           in.StereoDbond,
+			StereoSP3:             in.StereoSP3,
+			StereoSP3inverted:     in.StereoSP3inverted,
+			StereoType:            in.StereoType,
+			IsotopicAtoms:         in.IsotopicAtoms,
+			IsotopicExchangeableH: in.IsotopicExchangeableH,
+			FullStereo:            in.FullStereo,
+			FullIsotopic:          in.FullIsotopic,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	ps.count++
+	ps.lastID = strconv.Itoa(c.UCI)
+
+	if ps.count >= ps.Rotate {
+		return ps.Flush()
+	}
+	return nil
+}
+
+// parquetTime milliseconds since epoch, nil for the zero time
+func parquetTime(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+	ms := t.UnixMilli()
+	return &ms
+}
+
+// Flush finishes the current files of the three tables and reports them
+func (ps *ParquetSink) Flush() error {
+	if ps.files == nil {
+		ps.logger.Warn("No compounds on current parquet files, skipping them")
+		return nil
+	}
+
+	batch := int(atomic.AddInt64(&ps.sent, 1))
+	err := ps.close(true)
+	if err != nil {
+		return err
+	}
+	ps.logger.Debugf("Parquet part %d of partition %s written with %d compounds", ps.part, ps.Partition, ps.count)
+
+	ps.respchan <- WorkerResponse{
+		Succeeded:       ps.count,
+		Indexed:         ps.count,
+		Created:         ps.count,
+		LastSucceededID: ps.lastID,
+		Batch:           batch,
+	}
+	ps.count = 0
+	return nil
+}
+
+func (ps *ParquetSink) open() error {
+	ps.part++
+	schemas := []interface{}{new(parquetCompound), new(parquetXref), new(parquetComponent)}
+
+	for i, t := range parquetTables {
+		name := filepath.Join(ps.Dir, t, "uci_range="+ps.Partition, fmt.Sprintf("part-%05d.parquet.tmp", ps.part))
+		f, err := os.Create(name)
+		if err != nil {
+			_ = ps.close(false)
+			return err
+		}
+
+		pw, err := writer.NewParquetWriterFromWriter(f, schemas[i], 1)
+		if err != nil {
+			_ = f.Close()
+			_ = ps.close(false)
+			return err
+		}
+		pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+		ps.files = append(ps.files, &parquetFile{tmpName: name, file: f, writer: pw})
+	}
+	return nil
+}
+
+// close writes the footers of the current files and, when complete, moves them
+// to their final names. Partially written files keep their .tmp suffix
+func (ps *ParquetSink) close(complete bool) error {
+	files := ps.files
+	ps.files = nil
+
+	var err error
+	for _, pf := range files {
+		e := pf.writer.WriteStop()
+		if e2 := pf.file.Close(); e == nil {
+			e = e2
+		}
+		if e == nil && complete {
+			e = os.Rename(pf.tmpName, pf.tmpName[:len(pf.tmpName)-len(".tmp")])
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Close closes any files left open without a Flush, they keep their .tmp suffix
+func (ps *ParquetSink) Close() error {
+	if ps.files == nil {
+		return nil
+	}
+	ps.logger.Warnf("Parquet part %d of partition %s left incomplete", ps.part, ps.Partition)
+	return ps.close(false)
+}
+
+// Responses channel where every written part is reported
+func (ps *ParquetSink) Responses() <-chan WorkerResponse {
+	return ps.respchan
+}
+
+// Errors never used, write errors are returned by Add and Flush
+func (ps *ParquetSink) Errors() <-chan error {
+	return ps.errchan
+}
+
+// Sent number of parts finished
+func (ps *ParquetSink) Sent() int {
+	return int(atomic.LoadInt64(&ps.sent))
+}
+
+// Wait parts are written synchronously, nothing to wait for
+func (ps *ParquetSink) Wait() {}
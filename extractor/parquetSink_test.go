@@ -0,0 +1,118 @@
+package extractor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"go.uber.org/zap"
+)
+
+// readParquet the column names written in a Parquet file and its rows, read
+// into new values of the type of schema
+func readParquet(t *testing.T, path string, schema interface{}, rows interface{}) []string {
+	f, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Without a schema the one of the file is taken
+	pr, err := reader.NewParquetReader(f, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var columns []string
+	// The first element is the root of the schema
+	for _, tag := range pr.SchemaHandler.Infos[1:] {
+		columns = append(columns, tag.ExName)
+	}
+	pr.ReadStop()
+
+	pr, err = reader.NewParquetReader(f, schema, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	if err = pr.Read(rows); err != nil {
+		t.Fatal(err)
+	}
+	return columns
+}
+
+func TestParquetSinkTables(t *testing.T) {
+	dir := t.TempDir()
+	ps, err := NewParquetSink(zap.NewNop().Sugar(), Export{Path: dir, Rotate: 2}, "1-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := collectResponses(ps)
+
+	updated := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	for uci := 1; uci <= 3; uci++ {
+		c := Compound{
+			UCI:              uci,
+			Inchi:            Inchi{Inchi: "InChI=1S/CH4.H2O/h1H4;1H2", Formula: "CH4.H2O"},
+			Components:       []Inchi{{Inchi: "InChI=1S/CH4/h1H4"}, {Inchi: "InChI=1S/H2O/h1H2"}},
+			StandardInchiKey: fmt.Sprint("KEY", uci),
+			Sources: []CompoundSource{
+				{ID: 1, CompoundID: fmt.Sprint("CHEMBL", uci), LastUpdate: updated},
+				{ID: 2, CompoundID: fmt.Sprint("DB", uci)},
+			},
+		}
+		if err = ps.Add(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ps.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err = ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(ps.respchan)
+	if wrs := <-responses; len(wrs) != 2 || wrs[0].Indexed != 2 || wrs[1].Indexed != 1 || wrs[1].LastSucceededID != "3" {
+		t.Errorf("got responses %+v, want one per part", wrs)
+	}
+
+	for _, table := range parquetTables {
+		got := dirFiles(t, filepath.Join(dir, table, "uci_range=1-4"))
+		if strings.Join(got, " ") != "part-00001.parquet part-00002.parquet" {
+			t.Errorf("got %s files %v, want two parts", table, got)
+		}
+	}
+
+	compounds := make([]parquetCompound, 2)
+	columns := readParquet(t, filepath.Join(dir, "compounds", "uci_range=1-4", "part-00001.parquet"), new(parquetCompound), &compounds)
+	if len(columns) != 22 || columns[0] != "uci" || columns[1] != "standard_inchi_key" || columns[21] != "is_sourceless" {
+		t.Errorf("got compounds columns %v", columns)
+	}
+	if compounds[1].UCI != 2 || compounds[1].StandardInchiKey != "KEY2" || compounds[1].Formula != "CH4.H2O" || compounds[1].Sources != 2 || compounds[1].Components != 2 {
+		t.Errorf("got compound %+v, want UCI 2 with 2 sources and 2 components", compounds[1])
+	}
+
+	xrefs := make([]parquetXref, 2)
+	columns = readParquet(t, filepath.Join(dir, "xrefs", "uci_range=1-4", "part-00002.parquet"), new(parquetXref), &xrefs)
+	if len(columns) != 14 || columns[0] != "uci" || columns[1] != "src_id" || columns[2] != "compound_id" {
+		t.Errorf("got xrefs columns %v", columns)
+	}
+	if xrefs[0].UCI != 3 || xrefs[0].CompoundID != "CHEMBL3" || xrefs[0].LastUpdated == nil || *xrefs[0].LastUpdated != updated.UnixMilli() {
+		t.Errorf("got xref %+v, want CHEMBL3 last updated on %v", xrefs[0], updated)
+	}
+	if xrefs[1].CompoundID != "DB3" || xrefs[1].LastUpdated != nil {
+		t.Errorf("got xref %+v, want DB3 never updated", xrefs[1])
+	}
+
+	components := make([]parquetComponent, 2)
+	columns = readParquet(t, filepath.Join(dir, "components", "uci_range=1-4", "part-00002.parquet"), new(parquetComponent), &components)
+	if len(columns) != 16 || columns[1] != "component" {
+		t.Errorf("got components columns %v", columns)
+	}
+	if components[1].UCI != 3 || components[1].Component != 1 || components[1].Inchi != "InChI=1S/H2O/h1H2" {
+		t.Errorf("got component %+v, want the second one of UCI 3", components[1])
+	}
+}
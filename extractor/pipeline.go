@@ -0,0 +1,414 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SinkFactory opens the Sink a partition is written to, every extractor attempt
+// gets its own
+type SinkFactory func(ctx context.Context, l *zap.SugaredLogger, partition string) (Sink, error)
+
+// ConfiguredSink the SinkFactory of the sink set on the configuration
+func ConfiguredSink(conf *Configuration) SinkFactory {
+	return func(ctx context.Context, l *zap.SugaredLogger, partition string) (Sink, error) {
+		return newSink(ctx, l, conf, partition)
+	}
+}
+
+// Option sets up a Pipeline
+type Option func(p *Pipeline)
+
+// WithConfiguration takes the ranges, interval, query, concurrency, attempts and
+// shutdown timeout of conf. Options given after it override them
+func WithConfiguration(conf *Configuration) Option {
+	return func(p *Pipeline) {
+		p.conf = *conf
+	}
+}
+
+// WithLogger logs the run through l, nothing is logged by default
+func WithLogger(l *zap.SugaredLogger) Option {
+	return func(p *Pipeline) {
+		p.logger = l
+	}
+}
+
+// WithConsole prints the progress of the run on w, nothing is printed by default
+func WithConsole(w io.Writer) Option {
+	return func(p *Pipeline) {
+		p.console = &lockedWriter{w: w}
+	}
+}
+
+// lockedWriter serializes the writes of the extractors running at once
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(b []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(b)
+}
+
+// WithConcurrency number of extractors running at the same time, 1 by default
+func WithConcurrency(n int) Option {
+	return func(p *Pipeline) {
+		p.conf.MaxConcurrent = n
+	}
+}
+
+// WithRanges UCI ranges extracted, finish excluded
+func WithRanges(ranges ...Range) Option {
+	return func(p *Pipeline) {
+		p.conf.QueryRanges = ranges
+	}
+}
+
+// WithInterval UCIs queried by each extractor, by default every range is a
+// single partition
+func WithInterval(n int) Option {
+	return func(p *Pipeline) {
+		p.conf.Interval = n
+	}
+}
+
+// WithMaxAttempts times a failed partition is tried, 1 by default
+func WithMaxAttempts(n int) Option {
+	return func(p *Pipeline) {
+		p.conf.MaxAttempts = n
+	}
+}
+
+// WithCheckpoint records the UCIs confirmed by the sinks on cp, partitions it
+// has finished are skipped and the rest resumed from their last confirmed UCI
+func WithCheckpoint(cp *CheckpointStore) Option {
+	return func(p *Pipeline) {
+		p.checkpoint = cp
+	}
+}
+
+// Pipeline extracts the compounds of a RowSource into the sinks of a
+// SinkFactory, one extractor per partition of the UCI ranges
+type Pipeline struct {
+	src        RowSource
+	sinks      SinkFactory
+	logger     *zap.SugaredLogger
+	console    io.Writer
+	conf       Configuration
+	checkpoint *CheckpointStore
+}
+
+// NewPipeline sets up a Pipeline reading from src and writing through sinks.
+// The driver of src is taken from its type, database sources render the
+// configured query or the built-in one of the driver
+func NewPipeline(src RowSource, sinks SinkFactory, opts ...Option) *Pipeline {
+	p := &Pipeline{
+		src:    src,
+		sinks:  sinks,
+		logger: zap.NewNop().Sugar(),
+		conf:   Configuration{MaxConcurrent: 1, MaxAttempts: 1},
+	}
+	switch s := src.(type) {
+	case *SQLSource:
+		p.conf.Driver = s.Driver
+	case *FileSource:
+		p.conf.Driver = "files"
+	case *SDFSource:
+		p.conf.Driver = "sdf"
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// PartitionResult outcome of a partition. Skipped ones were finished by a
+// previous run, according to the checkpoint
+type PartitionResult struct {
+	Partition
+	Attempts int
+	// Batches sink responses, Indexed compounds accepted and Rejected the ones
+	// refused
+	Batches, Indexed, Rejected int
+	LastUCI                    int
+	Done, Skipped              bool
+}
+
+// RunResult what a Pipeline run went through. Failures lists the partitions
+// failed after every attempt, the error returned by Run holds them too
+type RunResult struct {
+	Partitions                 []PartitionResult
+	Batches, Indexed, Rejected int
+	Failures                   []*PartitionError
+	Elapsed                    time.Duration
+}
+
+// Run dispatches an extractor per partition and waits for all of them. The
+// error is ErrInterrupted when ctx is canceled, an ExtractionError when some
+// partition failed after every attempt, or the reason the run couldn't start
+func (p *Pipeline) Run(ctx context.Context) (RunResult, error) {
+	ti := time.Now()
+	l := p.logger
+	conf := &p.conf
+	cp := p.checkpoint
+	tracker := newRunTracker()
+	var extractors []*Extractor
+
+	if len(conf.QueryRanges) == 0 && conf.QueryMax == (Range{}) {
+		m := "No UCI range to extract, set one with WithRanges"
+		l.Error(m)
+		return tracker.result(ti), fmt.Errorf("%w: %s", ErrConfig, m)
+	}
+
+	if conf.Interval <= 0 {
+		for _, r := range conf.Ranges() {
+			if r.Finish-r.Start > conf.Interval {
+				conf.Interval = r.Finish - r.Start
+			}
+		}
+	}
+
+	if conf.MaxConcurrent <= 0 {
+		m := "Maximum number of concurrent extractors must be greater than zero"
+		l.Error(m)
+		return tracker.result(ti), fmt.Errorf("%w: %s", ErrConfig, m)
+	}
+	if conf.MaxAttempts <= 0 {
+		m := "Maximum number of extractor attempts must be defined and greater than zero"
+		l.Error(m)
+		return tracker.result(ti), fmt.Errorf("%w: %s", ErrConfig, m)
+	}
+	l.Info("MaxAttempts: ", conf.MaxAttempts)
+
+	_, err := conf.RangeQuery()
+	if err != nil {
+		l.Error(err)
+		return tracker.result(ti), tagError(ErrConfig, err)
+	}
+
+	partitions, err := planPartitions(conf)
+	if err != nil {
+		m := fmt.Sprint("Invalid query ranges ", err)
+		printConsole(p.console, m)
+		l.Error(m)
+		return tracker.result(ti), tagError(ErrConfig, err)
+	}
+
+	var extractorwg sync.WaitGroup
+	exResponse := make(chan extractionResponse)
+	extractorsAttempts := map[int]int{}
+	// mu guards extractors and extractorsAttempts, shared with the monitor
+	var mu sync.Mutex
+
+	l.Infof("MaxConcurrent set: %d", conf.MaxConcurrent)
+	lock := make(chan int, conf.MaxConcurrent)
+	monitorCtx, stopMonitor := context.WithCancel(ctx)
+	monitorDone := monitorExtraction(monitorCtx, l, p.console, conf, lock, &extractorwg, exResponse, &mu, &extractorsAttempts, &extractors)
+	// Nothing is printed on the console once Run returns
+	defer func() {
+		stopMonitor()
+		<-monitorDone
+	}()
+
+	for _, pa := range partitions {
+		tracker.plan(pa)
+	}
+
+	for _, pa := range partitions {
+		if ctx.Err() != nil {
+			m := "Run canceled, no more extractors are dispatched"
+			l.Warn(m)
+			printConsole(p.console, m)
+			break
+		}
+		if cp != nil {
+			pc := cp.Get(pa.ID)
+			if pc.Done || (pc.LastUCI >= pa.Start && pc.LastUCI+1 >= pa.Finish) {
+				m := fmt.Sprintf("Skipping Extractor ID: %d from %d to %d, finished on a previous run", pa.ID, pa.Start, pa.Finish)
+				l.Info(m)
+				printConsole(p.console, m)
+				tracker.skip(pa.ID, pc.LastUCI)
+				continue
+			}
+			if pc.LastUCI >= pa.Start {
+				pa.Start = pc.LastUCI + 1
+				pa.Query, _ = conf.renderQuery(pa.Start, pa.Finish)
+			}
+		}
+
+		m := fmt.Sprintf("Dispatching Extractor ID: %d from %d to %d ", pa.ID, pa.Start, pa.Finish)
+		l.Infof(m)
+		printConsole(p.console, m)
+		ex := Extractor{
+			id:          pa.ID,
+			Source:      p.src,
+			Query:       pa.Query,
+			QueryStart:  pa.Start,
+			QueryLimit:  pa.Finish,
+			Logger:      l,
+			LastIDAdded: 0,
+			checkpoint:  cp,
+			sinks:       p.sinks,
+			tracker:     tracker,
+			console:     p.console,
+		}
+
+		mu.Lock()
+		extractorsAttempts[pa.ID] = 1
+		extractors = append(extractors, &ex)
+		first := len(extractors) == 1
+		mu.Unlock()
+
+		extractorwg.Add(1)
+		go launchExtractor(ctx, l, conf, &ex, exResponse, lock, &extractorwg)
+
+		// Giving the first extractor a head start
+		if first {
+			time.Sleep(300 * time.Millisecond)
+		}
+	}
+
+	extractorwg.Wait()
+	l.Info("Wrapping it up")
+	mu.Lock()
+	printStatus(l, p.console, extractors)
+	mu.Unlock()
+	elapsedTime(l, p.console, ti)
+
+	if ctx.Err() != nil {
+		return tracker.result(ti), ErrInterrupted
+	}
+	return tracker.result(ti), tracker.err()
+}
+
+// printConsole prints m on the console w, when there's one
+func printConsole(w io.Writer, m string) {
+	if w != nil {
+		fmt.Fprintln(w, m)
+	}
+}
+
+// runTracker gathers the outcome of every partition from its extractors, the
+// error kept is the one of the partition's last attempt
+type runTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*PartitionResult
+	errs       map[int]*PartitionError
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{partitions: map[int]*PartitionResult{}, errs: map[int]*PartitionError{}}
+}
+
+// partition the result of the partition id, mu must be held
+func (rt *runTracker) partition(id int) *PartitionResult {
+	pr, ok := rt.partitions[id]
+	if !ok {
+		pr = &PartitionResult{Partition: Partition{ID: id}}
+		rt.partitions[id] = pr
+	}
+	return pr
+}
+
+func (rt *runTracker) plan(p Partition) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.partition(p.ID).Partition = p
+}
+
+func (rt *runTracker) skip(id, lastUCI int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	pr := rt.partition(id)
+	pr.Skipped = true
+	pr.Done = true
+	pr.LastUCI = lastUCI
+}
+
+func (rt *runTracker) attempt(ex *Extractor) {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.partition(ex.id).Attempts++
+}
+
+// response counts a sink response, LastUCI is the highest UCI confirmed
+func (rt *runTracker) response(ex *Extractor, wr WorkerResponse) {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	pr := rt.partition(ex.id)
+	pr.Batches++
+	pr.Indexed += wr.Succeeded
+	pr.Rejected += wr.Failed
+	if li, err := strconv.Atoi(wr.LastSucceededID); err == nil && li > pr.LastUCI {
+		pr.LastUCI = li
+	}
+}
+
+func (rt *runTracker) fail(ex *Extractor, err error) {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.errs[ex.id] = &PartitionError{ID: ex.id, Start: ex.QueryStart, Finish: ex.QueryLimit, Err: err}
+}
+
+func (rt *runTracker) done(ex *Extractor) {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.partition(ex.id).Done = true
+	delete(rt.errs, ex.id)
+}
+
+// failures the partitions still failed, sorted by ID. mu must be held
+func (rt *runTracker) failures() []*PartitionError {
+	var f []*PartitionError
+	for _, p := range rt.errs {
+		f = append(f, p)
+	}
+	sort.Slice(f, func(i, j int) bool { return f[i].ID < f[j].ID })
+	return f
+}
+
+// err an ExtractionError with the partitions still failed, nil when there's none
+func (rt *runTracker) err() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.errs) == 0 {
+		return nil
+	}
+	return &ExtractionError{Partitions: rt.failures()}
+}
+
+func (rt *runTracker) result(started time.Time) RunResult {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	res := RunResult{Failures: rt.failures(), Elapsed: time.Since(started)}
+	for _, pr := range rt.partitions {
+		res.Partitions = append(res.Partitions, *pr)
+		res.Batches += pr.Batches
+		res.Indexed += pr.Indexed
+		res.Rejected += pr.Rejected
+	}
+	sort.Slice(res.Partitions, func(i, j int) bool { return res.Partitions[i].ID < res.Partitions[j].ID })
+	return res
+}
@@ -0,0 +1,221 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeSinks a SinkFactory keeping the compounds added by every partition.
+// With failFirst the first sink of every partition can't be opened
+type fakeSinks struct {
+	mu        sync.Mutex
+	sinks     map[string]*fakeSink
+	err       error
+	failFirst bool
+	failed    map[string]bool
+}
+
+func (fs *fakeSinks) open(ctx context.Context, l *zap.SugaredLogger, partition string) (Sink, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.failFirst && !fs.failed[partition] {
+		if fs.failed == nil {
+			fs.failed = map[string]bool{}
+		}
+		fs.failed[partition] = true
+		return nil, errors.New("sink not ready")
+	}
+	if fs.sinks == nil {
+		fs.sinks = map[string]*fakeSink{}
+	}
+	s := &fakeSink{}
+	fs.sinks[partition] = s
+	return s, nil
+}
+
+func (fs *fakeSinks) ucis() []int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var ucis []int
+	for _, s := range fs.sinks {
+		for _, c := range s.added {
+			ucis = append(ucis, c.UCI)
+		}
+	}
+	sort.Ints(ucis)
+	return ucis
+}
+
+func TestPipelineRun(t *testing.T) {
+	src := &fakeRowSource{}
+	for uci := 1; uci <= 9; uci++ {
+		src.rows = append(src.rows, Row{UCI: uci, SrcID: 1, Assignment: 1})
+	}
+	sinks := &fakeSinks{}
+	var console bytes.Buffer
+
+	res, err := NewPipeline(src, sinks.open,
+		WithRanges(Range{Start: 1, Finish: 5}, Range{Start: 7, Finish: 10}),
+		WithInterval(2),
+		WithConcurrency(2),
+		WithConsole(&console),
+	).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{1, 2, 3, 4, 7, 8, 9}
+	if got := sinks.ucis(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got UCIs %v, want %v", got, want)
+	}
+	if len(res.Partitions) != 4 {
+		t.Fatalf("got %d partitions, want 4", len(res.Partitions))
+	}
+	for _, p := range res.Partitions {
+		if !p.Done || p.Attempts != 1 {
+			t.Errorf("partition %d: done %t after %d attempts", p.ID, p.Done, p.Attempts)
+		}
+	}
+	if len(res.Failures) != 0 {
+		t.Errorf("got failures %v", res.Failures)
+	}
+	if !strings.Contains(console.String(), "Dispatching Extractor ID") {
+		t.Errorf("progress not printed on the console:\n%s", console.String())
+	}
+}
+
+func TestPipelineRetriesFailedPartitions(t *testing.T) {
+	src := &fakeRowSource{}
+	for uci := 1; uci <= 6; uci++ {
+		src.rows = append(src.rows, Row{UCI: uci, SrcID: 1, Assignment: 1})
+	}
+	sinks := &fakeSinks{failFirst: true}
+	var console bytes.Buffer
+
+	res, err := NewPipeline(src, sinks.open,
+		WithRanges(Range{Start: 1, Finish: 7}),
+		WithInterval(3),
+		WithConcurrency(2),
+		WithMaxAttempts(2),
+		WithConsole(&console),
+	).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every retry is done by the time Run returns
+	want := []int{1, 2, 3, 4, 5, 6}
+	if got := sinks.ucis(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got UCIs %v, want %v", got, want)
+	}
+	for _, p := range res.Partitions {
+		if !p.Done || p.Attempts != 2 {
+			t.Errorf("partition %d: done %t after %d attempts, want done after 2", p.ID, p.Done, p.Attempts)
+		}
+	}
+	if !strings.Contains(console.String(), "ATTEMPT 2") {
+		t.Errorf("retries not printed on the console:\n%s", console.String())
+	}
+}
+
+func TestPipelineWithoutRanges(t *testing.T) {
+	_, err := NewPipeline(&fakeRowSource{}, (&fakeSinks{}).open).Run(context.Background())
+	if !errors.Is(err, ErrConfig) || !strings.Contains(err.Error(), "range") {
+		t.Errorf("got error %v, want a missing range", err)
+	}
+}
+
+func TestPipelineFailedPartition(t *testing.T) {
+	src := &fakeRowSource{rows: []Row{{UCI: 1, SrcID: 1, Assignment: 1}}}
+	sinks := &fakeSinks{err: errors.New("sink down")}
+
+	res, err := NewPipeline(src, sinks.open,
+		WithRanges(Range{Start: 1, Finish: 2}),
+		WithMaxAttempts(2),
+	).Run(context.Background())
+
+	var ee *ExtractionError
+	if !errors.As(err, &ee) || len(ee.Partitions) != 1 {
+		t.Fatalf("got error %v, want an ExtractionError with one partition", err)
+	}
+	if len(res.Partitions) != 1 || res.Partitions[0].Attempts != 2 || res.Partitions[0].Done {
+		t.Errorf("got partitions %+v, want one not done after 2 attempts", res.Partitions)
+	}
+}
+
+// stuckSink dispatches a batch on Flush whose response is only sent once
+// release is closed, cancel is called right after it
+type stuckSink struct {
+	fakeSink
+	cancel    context.CancelFunc
+	release   chan struct{}
+	responses chan WorkerResponse
+	wg        sync.WaitGroup
+	closed    chan struct{}
+}
+
+func (s *stuckSink) Flush() error {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-s.release
+		s.responses <- WorkerResponse{Succeeded: 1, LastSucceededID: "1", Batch: 1}
+	}()
+	s.cancel()
+	return nil
+}
+
+func (s *stuckSink) Responses() <-chan WorkerResponse { return s.responses }
+func (s *stuckSink) Sent() int                        { return 1 }
+func (s *stuckSink) Wait()                            { s.wg.Wait() }
+
+func (s *stuckSink) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestPipelineShutdownTimeoutReleasesTheSink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := &stuckSink{
+		cancel:    cancel,
+		release:   make(chan struct{}),
+		responses: make(chan WorkerResponse),
+		closed:    make(chan struct{}),
+	}
+	src := &fakeRowSource{rows: []Row{{UCI: 1, SrcID: 1, Assignment: 1}}}
+	open := func(ctx context.Context, l *zap.SugaredLogger, partition string) (Sink, error) {
+		return sink, nil
+	}
+
+	res, err := NewPipeline(src, open,
+		WithConfiguration(&Configuration{ShutdownTimeout: 1, MaxConcurrent: 1, MaxAttempts: 1}),
+		WithRanges(Range{Start: 1, Finish: 2}),
+	).Run(ctx)
+	if err != ErrInterrupted {
+		t.Fatalf("got error %v, want %v", err, ErrInterrupted)
+	}
+	if len(res.Partitions) != 1 || res.Partitions[0].Done {
+		t.Errorf("timed out partition marked done: %+v", res.Partitions)
+	}
+
+	// The response arriving after the timeout doesn't block the sink forever
+	close(sink.release)
+	select {
+	case <-sink.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink not closed after its batch was done")
+	}
+}
@@ -0,0 +1,68 @@
+package extractor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Row is a single compound/source pair as returned by the UniChem query, a
+// compound with several sources spans as many consecutive rows
+type Row struct {
+	UCI                   int
+	StandardInchi         string
+	StandardInchiKey      string
+	Smiles                string
+	SrcCompoundID         string
+	Assignment            int
+	Created               time.Time
+	LastUpdated           time.Time
+	AuxSrc                string
+	SrcID                 int
+	SrcNameLong           string
+	SrcName               string
+	SrcDescription        string
+	SrcBaseURL            string
+	SrcShortName          string
+	SrcBaseIDURLAvailable int
+	SrcAuxForURL          int
+	SrcPrivate            int
+}
+
+// rowColumns number of columns selected by every compound query, one per Row field
+const rowColumns = 18
+
+// RowQuery describes the rows requested by an Extractor. Database sources run
+// the rendered SQL, other sources only use the UCI range (Finish 0 means no
+// upper bound)
+type RowQuery struct {
+	Start, Finish int
+	SQL           string
+}
+
+// RowIterator walks through the rows returned by a RowSource, it follows
+// the same contract as sql.Rows
+type RowIterator interface {
+	Next() bool
+	Scan(r *Row) error
+	Err() error
+	Close() error
+}
+
+// RowSource yields the UniChem rows ordered by UCI. Implementations must be safe
+// to query from several extractors at the same time
+type RowSource interface {
+	Rows(ctx context.Context, q RowQuery) (RowIterator, error)
+	Close() error
+}
+
+func newRowSource(conf *Configuration, l *zap.SugaredLogger) (RowSource, error) {
+	switch conf.DBDriver() {
+	case "files":
+		return NewFileSource(conf.Files, l)
+	case "sdf":
+		return NewSDFSource(conf.SDF)
+	}
+	return NewSQLSource(conf.DBDriver(), conf.DBConn())
+}
@@ -0,0 +1,277 @@
+package extractor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SDFSourceField maps an SD data field holding compound IDs onto a source, every
+// non empty line of the field is added as a compound ID of that source
+type SDFSourceField struct {
+	Field       string
+	ID          int
+	Name        string
+	LongName    string
+	Label       string
+	Description string
+	BaseURL     string
+	Private     bool
+}
+
+// SDFMapping the SD file to index and the data fields holding each Compound
+// property. When no UCI field is given records are numbered from 1 in file order,
+// otherwise the records must be sorted by it
+type SDFMapping struct {
+	Path     string
+	UCI      string
+	Inchi    string
+	InchiKey string
+	Smiles   string
+	Sources  []SDFSourceField
+}
+
+// SDFSource is a RowSource reading the data fields of an SD file, optionally gzipped
+type SDFSource struct {
+	mapping SDFMapping
+	created time.Time
+}
+
+// NewSDFSource checks the SD file exists and the mapping is usable
+func NewSDFSource(mapping SDFMapping) (*SDFSource, error) {
+	if len(mapping.Path) == 0 {
+		return nil, fmt.Errorf("SD file path can't be empty")
+	}
+	if len(mapping.Inchi) == 0 && len(mapping.InchiKey) == 0 && len(mapping.Smiles) == 0 {
+		return nil, fmt.Errorf("SD file mapping needs at least one of inchi, inchikey or smiles fields")
+	}
+
+	fi, err := os.Stat(mapping.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SDFSource{mapping: mapping, created: fi.ModTime()}, nil
+}
+
+// Rows reads the SD records within the RowQuery UCI range, a record yields one
+// row per compound ID found on its source fields or one unassigned row when none
+func (s *SDFSource) Rows(ctx context.Context, q RowQuery) (RowIterator, error) {
+	f, err := openDump(s.mapping.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	return &sdfRows{
+		ctx:     ctx,
+		query:   q,
+		mapping: s.mapping,
+		created: s.created,
+		file:    f,
+		scanner: sc,
+	}, nil
+}
+
+// Close nothing to release, the file is closed with its RowIterator
+func (s *SDFSource) Close() error {
+	return nil
+}
+
+type sdfRows struct {
+	ctx     context.Context
+	query   RowQuery
+	mapping SDFMapping
+	created time.Time
+	file    io.ReadCloser
+	scanner *bufio.Scanner
+	line    int
+	record  int
+	lastUCI int
+	// done the records left are past the query range
+	done    bool
+	pending []Row
+	row     Row
+	err     error
+}
+
+func (r *sdfRows) Next() bool {
+	for len(r.pending) == 0 {
+		if r.done {
+			return false
+		}
+		if err := r.ctx.Err(); err != nil {
+			r.err = err
+			return false
+		}
+
+		fields, ok, err := r.readRecord()
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if !ok {
+			return false
+		}
+		r.record++
+
+		r.pending, err = r.recordRows(fields)
+		if err != nil {
+			r.err = err
+			return false
+		}
+	}
+
+	r.row = r.pending[0]
+	r.pending = r.pending[1:]
+	return true
+}
+
+// readRecord reads the data items of the next record up to its $$$$ line
+func (r *sdfRows) readRecord() (map[string][]string, bool, error) {
+	fields := make(map[string][]string)
+	inData := false
+	current := ""
+	read := false
+
+	for r.scanner.Scan() {
+		r.line++
+		read = true
+		line := strings.TrimRight(r.scanner.Text(), "\r")
+
+		if strings.HasPrefix(line, "$$$$") {
+			return fields, true, nil
+		}
+		if strings.HasPrefix(line, "M  END") {
+			inData = true
+			continue
+		}
+		if !inData {
+			continue
+		}
+
+		if strings.HasPrefix(line, ">") {
+			// The field name is the first <...> of the header, e.g. > 25 <MP> (MD-08974)
+			a := strings.Index(line, "<")
+			b := -1
+			if a >= 0 {
+				b = strings.Index(line[a+1:], ">")
+			}
+			if b < 0 {
+				return nil, false, fmt.Errorf("%s:%d: bad data header %s", r.mapping.Path, r.line, line)
+			}
+			current = line[a+1 : a+1+b]
+			fields[current] = nil
+			continue
+		}
+
+		if len(strings.TrimSpace(line)) == 0 {
+			current = ""
+			continue
+		}
+		if len(current) > 0 {
+			fields[current] = append(fields[current], strings.TrimSpace(line))
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", r.mapping.Path, err)
+	}
+
+	// Last record without a closing $$$$
+	return fields, read && inData, nil
+}
+
+func (r *sdfRows) recordRows(fields map[string][]string) ([]Row, error) {
+	m := r.mapping
+
+	uci := r.record
+	if len(m.UCI) > 0 {
+		v := first(fields[m.UCI])
+		if len(v) == 0 {
+			return nil, fmt.Errorf("%s: record %d without %s field", m.Path, r.record, m.UCI)
+		}
+		var err error
+		uci, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: record %d: %w", m.Path, r.record, err)
+		}
+		if uci < r.lastUCI {
+			return nil, fmt.Errorf("%s: record %d: not sorted by %s, found %d after %d", m.Path, r.record, m.UCI, uci, r.lastUCI)
+		}
+		r.lastUCI = uci
+	}
+
+	// Records are sorted by UCI, none of the following is in range either
+	if r.query.Finish > 0 && uci >= r.query.Finish {
+		r.done = true
+		return nil, nil
+	}
+	if uci < r.query.Start {
+		return nil, nil
+	}
+
+	base := Row{
+		UCI:              uci,
+		StandardInchi:    first(fields[m.Inchi]),
+		StandardInchiKey: first(fields[m.InchiKey]),
+		Smiles:           first(fields[m.Smiles]),
+		Created:          r.created,
+	}
+
+	var rows []Row
+	for _, sf := range m.Sources {
+		for _, id := range fields[sf.Field] {
+			row := base
+			row.SrcCompoundID = id
+			row.Assignment = 1
+			row.SrcID = sf.ID
+			row.SrcShortName = sf.Name
+			row.SrcNameLong = sf.LongName
+			row.SrcName = sf.Label
+			if len(row.SrcName) == 0 {
+				row.SrcName = sf.Name
+			}
+			row.SrcDescription = sf.Description
+			row.SrcBaseURL = sf.BaseURL
+			if len(sf.BaseURL) > 0 {
+				row.SrcBaseIDURLAvailable = 1
+			}
+			if sf.Private {
+				row.SrcPrivate = 1
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) == 0 {
+		rows = append(rows, base)
+	}
+	return rows, nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (r *sdfRows) Scan(row *Row) error {
+	*row = r.row
+	return nil
+}
+
+func (r *sdfRows) Err() error {
+	return r.err
+}
+
+func (r *sdfRows) Close() error {
+	return r.file.Close()
+}
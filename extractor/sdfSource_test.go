@@ -0,0 +1,95 @@
+package extractor
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func sdfMapping(name string) SDFMapping {
+	return SDFMapping{
+		Path:     filepath.Join("testdata", "sdf", name),
+		UCI:      "UCI",
+		InchiKey: "INCHIKEY",
+		Sources: []SDFSourceField{
+			{Field: "CHEMBL_ID", ID: 1, Name: "chembl"},
+			{Field: "DRUGBANK_ID", ID: 2, Name: "drugbank"},
+		},
+	}
+}
+
+// sdfRowKeys the UCI, InChIKey and compound ID of every row
+func sdfRowKeys(rows []Row) string {
+	var keys []string
+	for _, r := range rows {
+		keys = append(keys, strings.Join([]string{strconv.Itoa(r.UCI), r.StandardInchiKey, r.SrcCompoundID}, ":"))
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestSDFSourceRows(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mapping SDFMapping
+		query   RowQuery
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "multi-line fields and a last record without $$$$",
+			mapping: sdfMapping("compounds.sdf"),
+			want: "1:VNWKTOKETHGBQD-UHFFFAOYSA-N:CHEMBL17564 1:VNWKTOKETHGBQD-UHFFFAOYSA-N:CHEMBL_SALT 1:VNWKTOKETHGBQD-UHFFFAOYSA-N:DB15994 " +
+				"2:XLYOFNOQVPJJNP-UHFFFAOYSA-N: 5:MYMOFIZGZYHOMD-UHFFFAOYSA-N:CHEMBL1234",
+		},
+		{
+			name:    "range",
+			mapping: sdfMapping("compounds.sdf"),
+			query:   RowQuery{Start: 2, Finish: 5},
+			want:    "2:XLYOFNOQVPJJNP-UHFFFAOYSA-N:",
+		},
+		{
+			name: "numbered records",
+			mapping: SDFMapping{
+				Path:     filepath.Join("testdata", "sdf", "missing_uci.sdf"),
+				InchiKey: "INCHIKEY",
+			},
+			want: "1:VNWKTOKETHGBQD-UHFFFAOYSA-N: 2:XLYOFNOQVPJJNP-UHFFFAOYSA-N:",
+		},
+		{
+			name:    "missing UCI",
+			mapping: sdfMapping("missing_uci.sdf"),
+			wantErr: "record 2 without UCI field",
+		},
+		{
+			name:    "unsorted",
+			mapping: sdfMapping("unsorted.sdf"),
+			wantErr: "not sorted by UCI, found 2 after 5",
+		},
+		{
+			// The records past the range are not read, nor is the unsorted one
+			name:    "unsorted past the range",
+			mapping: sdfMapping("unsorted.sdf"),
+			query:   RowQuery{Finish: 5},
+			want:    "1:VNWKTOKETHGBQD-UHFFFAOYSA-N:",
+		},
+	} {
+		src, err := NewSDFSource(tc.mapping)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		rows, err := readRows(src, tc.query)
+		if len(tc.wantErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: got error %v, want %s", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := sdfRowKeys(rows); got != tc.want {
+			t.Errorf("%s: got rows %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// WorkerResponse contains the result of a batch of compounds written by a Sink
+type WorkerResponse struct {
+	Succeeded int
+	Indexed   int
+	Created   int
+	Updated   int
+	Deleted   int
+	Failed    int
+	// Took milliseconds spent writing the batch, when reported by the target
+	Took int
+	// Errors the target flagged the batch as having errors
+	Errors bool
+	// LastSucceededID ID (UCI) of the last compound written successfully
+	LastSucceededID string
+	FailedItems     []FailedItem
+	// Batch sequence number of the batch within its Sink, starting at 1 in
+	// dispatch order. Responses may arrive out of order
+	Batch int
+}
+
+// FailedItem a compound rejected by the Sink target
+type FailedItem struct {
+	ID     string
+	Reason string
+}
+
+// Sink receives the compounds built by an Extractor. Compounds are written in
+// batches, possibly in the background, and the outcome of each batch is
+// reported through Responses or Errors
+type Sink interface {
+	// Add queues a compound, sending the current batch when full
+	Add(c Compound) error
+	// Flush sends the current batch regardless of its size
+	Flush() error
+	// Close releases the connections or files held by the Sink
+	Close() error
+	// Responses reports every batch written
+	Responses() <-chan WorkerResponse
+	// Errors reports batches that couldn't be written at all
+	Errors() <-chan error
+	// Sent number of batches dispatched so far
+	Sent() int
+	// Wait blocks until the dispatched batches are done
+	Wait()
+}
+
+// SinkNames every Sink built in, as set on the sink configuration
+var SinkNames = []string{"elasticsearch", "opensearch", "mongo", "file", "parquet"}
+
+// newSink creates the configured Sink for an extractor, partition names the
+// extractor's UCI range
+func newSink(ctx context.Context, l *zap.SugaredLogger, conf *Configuration, partition string) (Sink, error) {
+	switch conf.SinkName() {
+	case "elasticsearch":
+		return getElasticManager(ctx, l, conf)
+	case "file":
+		s, err := NewFileSink(l, conf.Export, conf.IndexName(), partition)
+		if err != nil {
+			return nil, tagError(ErrSinkUnavailable, err)
+		}
+		s.TypeName = conf.TypeName()
+		return s, nil
+	case "parquet":
+		s, err := NewParquetSink(l, conf.Export, partition)
+		if err != nil {
+			return nil, tagError(ErrSinkUnavailable, err)
+		}
+		return s, nil
+	case "opensearch":
+		return NewOpenSearchSink(ctx, l, conf, conf.IndexName())
+	case "mongo":
+		return NewMongoSink(ctx, l, conf)
+	}
+	return nil, fmt.Errorf("unknown sink %s", conf.SinkName())
+}
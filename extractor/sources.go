@@ -33,9 +33,14 @@ type Source struct {
 
 func getOriginalSources(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) ([]Source, error) {
 	l.Info("Fetching sources from origin DB")
-	db, err := sql.Open("godror", conf.OracleConn)
+	d, err := getDialect(conf.DBDriver())
 	if err != nil {
-		m := fmt.Sprint("Go oracle open ERROR ")
+		return nil, err
+	}
+
+	db, err := sql.Open(conf.DBDriver(), conf.DBConn())
+	if err != nil {
+		m := fmt.Sprint("Database open ERROR ")
 		fmt.Println(m)
 		l.Error(m)
 		return nil, err
@@ -43,35 +48,14 @@ func getOriginalSources(ctx context.Context, l *zap.SugaredLogger, conf *Configu
 	defer func(db *sql.DB) {
 		err := db.Close()
 		if err != nil {
-			m := fmt.Sprint("Go oracle Closing DB ", err)
+			m := fmt.Sprint("Database Closing DB ", err)
 			fmt.Println(m)
 			l.Error(m)
 		}
 	}(db)
-	l.Info("Success connecting to Oracle DB")
+	l.Info("Success connecting to origin DB")
 
-	srcQuery := `
-SELECT so.SRC_ID,
-       so.NAME,
-       so.DESCRIPTION,
-       ur.SRC_RELEASE_NUMBER,
-       ur.SRC_RELEASE_DATE,
-       so.CREATED,
-       so.LAST_UPDATED,
-       so.NAME_LONG,
-       so.SRC_DETAILS,
-       so.SRC_URL,
-       so.BASE_ID_URL,
-       so.AUX_FOR_URL,
-       so.BASE_ID_URL_AVAILABLE,
-       so.PRIVATE,
-       so.NAME_LABEL,
-       so.UPDATE_COMMENTS
-FROM UC_SOURCE so,
-     UC_RELEASE ur
-WHERE so.CURRENT_RELEASE_U = ur.RELEASE_U
-AND so.SRC_ID = ur.SRC_ID
-ORDER BY so.SRC_ID`
+	srcQuery := d.sourcesQuery
 
 	var (
 		sourceID                                int
@@ -85,7 +69,7 @@ ORDER BY so.SRC_ID`
 
 	rows, err := db.QueryContext(ctx, srcQuery)
 	if err != nil {
-		m := fmt.Sprint("Failed to perform Oracle query")
+		m := fmt.Sprint("Failed to perform sources query")
 		fmt.Println(m)
 		l.Error(m)
 		return nil, err
@@ -96,7 +80,7 @@ ORDER BY so.SRC_ID`
 
 		select {
 		case <-ctx.Done():
-			l.Warnf("Context done, ending OraDB sources load earlier")
+			l.Warnf("Context done, ending DB sources load earlier")
 		default:
 			err := rows.Scan(
 				&sourceID,
@@ -210,8 +194,8 @@ ORDER BY so.SRC_ID`
 func fetchUCICounts(ctx context.Context, l *zap.SugaredLogger, conf *Configuration) (map[int]UCICount, error) {
 	es := ElasticManager{
 		Context:   ctx,
-		IndexName: "unichem",
-		TypeName:  "compound",
+		IndexName: conf.StatsIndexName(),
+		TypeName:  conf.TypeName(),
 	}
 
 	err := es.Init(ctx, conf, l)
@@ -243,7 +227,7 @@ func LoadSources(ctx context.Context, l *zap.SugaredLogger, conf *Configuration)
 		m := fmt.Sprint("Failed to getSources")
 		fmt.Println(m)
 		l.Error(m)
-		return err
+		return tagError(ErrSourceUnavailable, err)
 	}
 
 	mc := conf.MongoDB
@@ -253,17 +237,17 @@ func LoadSources(ctx context.Context, l *zap.SugaredLogger, conf *Configuration)
 		m := fmt.Sprint("Failed to connect to Mongo DB")
 		fmt.Println(m)
 		l.Error(m)
-		return err
+		return tagError(ErrSinkUnavailable, err)
 	}
 	defer func(client *mongo.Client, ctx context.Context) {
 		err := client.Disconnect(ctx)
 		if err != nil {
-			l.Panic("Failed to close MongoDB")
+			l.Error("Failed to close MongoDB ", err)
 		}
 	}(client, ctx)
 	l.Debug("Connected to Mongo")
 
-	sources := client.Database("ci_cache").Collection("source")
+	sources := client.Database(conf.MongoDatabaseName()).Collection(conf.MongoSourceCollectionName())
 
 	o := options.Update().SetUpsert(true)
 	for _, so := range originalSources {
@@ -271,13 +255,13 @@ func LoadSources(ctx context.Context, l *zap.SugaredLogger, conf *Configuration)
 
 		m := fmt.Sprint("Inserting: ", so.Name, " Private: ", so.Private, " ID: ", so.SourceID, " HasAuxForURL: ", so.AuxForURL)
 		l.Debug(m)
-		up := bson.D{{"$set", so}}
+		up := bson.D{{Key: "$set", Value: so}}
 		_, err = sources.UpdateByID(ctx, so.SourceID, up, o)
 		if err != nil {
 			m := fmt.Sprint("Failed to insert source: ", so.Name)
 			fmt.Println(m)
 			l.Error(m)
-			return err
+			return tagError(ErrSinkRejected, err)
 		}
 	}
 	m := fmt.Sprintf("%d Sources successfully added to de DB", len(originalSources))
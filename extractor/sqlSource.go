@@ -0,0 +1,120 @@
+package extractor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLSource is a RowSource backed by a database/sql driver, the query must
+// select the 18 UniChem columns in the order expected by sqlRows.Scan
+type SQLSource struct {
+	Driver string
+	db     *sql.DB
+}
+
+// NewSQLSource opens a connection pool using the given driver name and DSN
+func NewSQLSource(driver, dsn string) (*SQLSource, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLSource{Driver: driver, db: db}, nil
+}
+
+// Rows runs the rendered SQL of the RowQuery
+func (s *SQLSource) Rows(ctx context.Context, q RowQuery) (RowIterator, error) {
+	rows, err := s.db.QueryContext(ctx, q.SQL)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlRows{rows: rows}, nil
+}
+
+// checkQuery runs the query limited to a few rows, checking it selects the
+// expected columns and they can be scanned into a Row
+func (s *SQLSource) checkQuery(ctx context.Context, query string, limit int) error {
+	d, err := getDialect(s.Driver)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(d.limitQuery, query, limit))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(cols) != rowColumns {
+		return fmt.Errorf("query selects %d columns, %d expected", len(cols), rowColumns)
+	}
+
+	sr := &sqlRows{rows: rows}
+	var r Row
+	for sr.Next() {
+		err = sr.Scan(&r)
+		if err != nil {
+			return err
+		}
+	}
+	return sr.Err()
+}
+
+// Close closes the underlying connection pool
+func (s *SQLSource) Close() error {
+	return s.db.Close()
+}
+
+type sqlRows struct {
+	rows *sql.Rows
+}
+
+func (r *sqlRows) Next() bool {
+	return r.rows.Next()
+}
+
+func (r *sqlRows) Scan(row *Row) error {
+	var lastUpdated sql.NullTime
+
+	err := r.rows.Scan(
+		&row.UCI,
+		&row.StandardInchi,
+		&row.StandardInchiKey,
+		&row.Smiles,
+		&row.SrcCompoundID,
+		&row.Assignment,
+		&row.Created,
+		&lastUpdated,
+		&row.AuxSrc,
+		&row.SrcID,
+		&row.SrcNameLong,
+		&row.SrcName,
+		&row.SrcDescription,
+		&row.SrcBaseURL,
+		&row.SrcShortName,
+		&row.SrcBaseIDURLAvailable,
+		&row.SrcAuxForURL,
+		&row.SrcPrivate)
+	if err != nil {
+		return err
+	}
+
+	row.LastUpdated = time.Time{}
+	if lastUpdated.Valid {
+		row.LastUpdated = lastUpdated.Time
+	}
+	return nil
+}
+
+func (r *sqlRows) Err() error {
+	return r.rows.Err()
+}
+
+func (r *sqlRows) Close() error {
+	return r.rows.Close()
+}
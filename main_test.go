@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chembl/unichem2index/extractor"
+)
+
+func TestRedactConsole(t *testing.T) {
+	conf := &extractor.Configuration{
+		OracleConn:  "scott/tiger@oradb:1521/xe",
+		ElasticAuth: extractor.ElasticAuth{Username: "elastic", Password: "authpass"},
+	}
+
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+
+	restore := redactConsole(conf.Secrets())
+	fmt.Println("Database open ERROR", conf.OracleConn)
+	fmt.Printf("Elastic password %s, no newline", conf.ElasticAuth.Password)
+	restore()
+
+	if os.Stdout != out {
+		t.Fatal("stdout not restored")
+	}
+	_, _ = out.Seek(0, io.SeekStart)
+	b, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed := string(b)
+	for _, s := range []string{"tiger", "authpass", conf.OracleConn} {
+		if strings.Contains(printed, s) {
+			t.Errorf("%q printed to the console:\n%s", s, printed)
+		}
+	}
+	if !strings.Contains(printed, "Database open ERROR") || !strings.Contains(printed, "no newline") {
+		t.Errorf("console output lost:\n%s", printed)
+	}
+}